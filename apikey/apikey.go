@@ -0,0 +1,220 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+// keyPrefix starts every issued key so leaked keys are easy to spot.
+const keyPrefix = "vsk_"
+
+// Key is a stored API key. The secret itself is never stored, only its hash.
+type Key struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Scopes       []string          `json:"scopes"`
+	Metadata     map[string]string `json:"metadata"`
+	DailyQuota   int64             `json:"daily_quota"`
+	MonthlyQuota int64             `json:"monthly_quota"`
+	CreatedAt    time.Time         `json:"created_at"`
+	RevokedAt    *time.Time        `json:"revoked_at,omitempty"`
+	Hash         string            `json:"hash"`
+}
+
+// IssueOptions describes a new key. Zero quotas mean unlimited.
+type IssueOptions struct {
+	Name         string
+	Scopes       []string
+	Metadata     map[string]string
+	DailyQuota   int64
+	MonthlyQuota int64
+}
+
+// Manager issues, authenticates and revokes API keys stored in Redis.
+type Manager struct {
+	redis *redisutil.Redis
+}
+
+/*
+consumeQuota increments the daily and monthly counters only if neither quota
+is exhausted, so rejected calls do not use up quota.
+
+KEYS: daily counter, monthly counter.
+ARGV: daily quota, monthly quota (0 = unlimited), daily ttl s, monthly ttl s.
+*/
+var consumeQuota = redisutil.RegisterScript("apikey:quota:consume", `
+for i = 1, 2 do
+	local quota = tonumber(ARGV[i])
+	if quota > 0 and tonumber(redis.call('GET', KEYS[i]) or '0') >= quota then
+		return i
+	end
+end
+for i = 1, 2 do
+	if redis.call('INCR', KEYS[i]) == 1 then
+		redis.call('EXPIRE', KEYS[i], ARGV[i + 2])
+	end
+end
+return 0
+`)
+
+func NewManager(r *redisutil.Redis) *Manager {
+	return &Manager{redis: r}
+}
+
+// Issue creates a key and returns its plaintext, which must be shown to the
+// caller once and cannot be recovered afterwards.
+func (m *Manager) Issue(opts IssueOptions) (string, Key, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return "", Key{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Key{}, err
+	}
+
+	key := Key{
+		ID:           id,
+		Name:         opts.Name,
+		Scopes:       opts.Scopes,
+		Metadata:     opts.Metadata,
+		DailyQuota:   opts.DailyQuota,
+		MonthlyQuota: opts.MonthlyQuota,
+		CreatedAt:    time.Now(),
+		Hash:         hashSecret(secret),
+	}
+	if err := m.redis.SetStruct(recordKey(id), key, 0); err != nil {
+		return "", Key{}, err
+	}
+
+	return keyPrefix + id + "." + secret, key, nil
+}
+
+// Get returns the stored key with the given ID.
+func (m *Manager) Get(id string) (Key, error) {
+	key := Key{}
+	if err := m.redis.GetStruct(recordKey(id), &key); err != nil {
+		if err == redis.Nil {
+			return Key{}, errutil.ErrAPIKeyInvalid
+		}
+		return Key{}, err
+	}
+
+	return key, nil
+}
+
+// Authenticate returns the key matching plaintext. Unknown, malformed and
+// revoked keys all return errutil.ErrAPIKeyInvalid.
+func (m *Manager) Authenticate(plaintext string) (Key, error) {
+	id, secret, ok := parse(plaintext)
+	if !ok {
+		return Key{}, errutil.ErrAPIKeyInvalid
+	}
+
+	key, err := m.Get(id)
+	if err != nil {
+		return Key{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashSecret(secret))) != 1 {
+		return Key{}, errutil.ErrAPIKeyInvalid
+	}
+	if key.RevokedAt != nil {
+		return Key{}, errutil.ErrAPIKeyInvalid
+	}
+
+	return key, nil
+}
+
+// Revoke disables the key with the given ID. The record is kept for audit.
+func (m *Manager) Revoke(id string) error {
+	key, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+
+	return m.redis.SetStruct(recordKey(id), key, 0)
+}
+
+// HasScope reports whether key grants scope.
+func (k Key) HasScope(scope string) bool {
+	return utils.InArray(scope, k.Scopes)
+}
+
+// Consume counts one call against the daily and monthly quotas of key,
+// returning errutil.ErrQuotaExceeded once either is exhausted.
+func (m *Manager) Consume(key Key, now time.Time) error {
+	now = now.UTC()
+	keys := []string{
+		recordKey(key.ID) + ":quota:d:" + now.Format("2006-01-02"),
+		recordKey(key.ID) + ":quota:m:" + now.Format("2006-01"),
+	}
+
+	// counters outlive their period a little to absorb clock skew
+	res, err := consumeQuota.Run(m.redis, keys,
+		key.DailyQuota, key.MonthlyQuota,
+		int64((48 * time.Hour).Seconds()), int64((32 * 24 * time.Hour).Seconds()))
+	if err != nil {
+		return err
+	}
+	if exceeded, _ := res.(int64); exceeded != 0 {
+		return errutil.ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+func parse(plaintext string) (string, string, bool) {
+	if !strings.HasPrefix(plaintext, keyPrefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(plaintext, keyPrefix), ".", 2)
+	if len(parts) != 2 || !validID(parts[0]) || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// validID reports whether id has the form Issue generates, 16 lowercase hex
+// characters, so that no other Redis key can be looked up through it.
+func validID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func recordKey(id string) string {
+	return "apikey:" + id
+}
@@ -0,0 +1,82 @@
+package apikey
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+const (
+	// HeaderAPIKey carries the key, "Authorization: Bearer <key>" works too.
+	HeaderAPIKey = "X-API-Key"
+
+	contextKey = "apikey"
+)
+
+/*
+Middleware authenticates requests with their API key, checks it grants every
+scope given and counts the call against its quotas. It responds with 401 for
+missing or invalid keys, 403 for missing scopes and 429 once a quota is
+exhausted. The key is available to handlers through FromContext.
+*/
+func Middleware(m *Manager, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			plaintext := extract(c.Request())
+			if plaintext == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing api key")
+			}
+
+			key, err := m.Authenticate(plaintext)
+			if err != nil {
+				if err == errutil.ErrAPIKeyInvalid {
+					return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+				}
+				logger.StdError("failed to authenticate api key: ", err)
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			}
+
+			for _, scope := range scopes {
+				if !key.HasScope(scope) {
+					return echo.NewHTTPError(http.StatusForbidden, "api key lacks scope "+scope)
+				}
+			}
+
+			if err := m.Consume(key, time.Now()); err != nil {
+				if err == errutil.ErrQuotaExceeded {
+					return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+				}
+				logger.StdError("failed to consume api key quota: ", err)
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			}
+
+			// handlers have no use for the secret hash
+			key.Hash = ""
+			c.Set(contextKey, key)
+			return next(c)
+		}
+	}
+}
+
+// FromContext returns the key authenticated by Middleware, without its Hash.
+func FromContext(c echo.Context) (Key, bool) {
+	key, ok := c.Get(contextKey).(Key)
+	return key, ok
+}
+
+func extract(r *http.Request) string {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+
+	auth := r.Header.Get(echo.HeaderAuthorization)
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return ""
+}
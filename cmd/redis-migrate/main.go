@@ -0,0 +1,100 @@
+/*
+Command redis-migrate copies or moves every key under a prefix to a new
+prefix, on the same Redis or on another one, keeping TTLs.
+
+	redis-migrate -from-prefix old: -to-prefix new: -move
+	redis-migrate -from-host a -from-prefix svc: -to-host b -rate 500
+	redis-migrate -from-prefix svc: -to-prefix svc: -to-db 2
+
+Target connection flags left unset default to the source ones.
+
+Interrupted runs print the cursor to pass to -cursor to resume.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+func main() {
+	fromHost := flag.String("from-host", "localhost", "source redis host")
+	fromPort := flag.String("from-port", "6379", "source redis port")
+	fromPass := flag.String("from-pass", "", "source redis password")
+	fromDB := flag.Int("from-db", 0, "source redis db")
+	fromPrefix := flag.String("from-prefix", "", "prefix of the keys to copy")
+	toHost := flag.String("to-host", "", "target redis host, defaults to the source")
+	toPort := flag.String("to-port", "", "target redis port, defaults to the source")
+	toPass := flag.String("to-pass", "", "target redis password, defaults to the source")
+	toDB := flag.Int("to-db", 0, "target redis db, defaults to the source")
+	toPrefix := flag.String("to-prefix", "", "prefix of the copied keys")
+	move := flag.Bool("move", false, "delete source keys once copied")
+	replace := flag.Bool("replace", false, "overwrite existing target keys")
+	batch := flag.Int64("batch", 100, "SCAN count hint")
+	rate := flag.Int("rate", 0, "keys per second, 0 for no limit")
+	cursor := flag.Uint64("cursor", 0, "cursor to resume from")
+	flag.Parse()
+
+	if *fromPrefix == "" {
+		fmt.Fprintln(os.Stderr, "-from-prefix is required")
+		os.Exit(2)
+	}
+
+	source, err := redisutil.Dial(*fromHost, *fromPort, *fromPass, *fromDB, *fromPrefix)
+	if err != nil {
+		os.Exit(1)
+	}
+	defer source.Close()
+
+	opts := redisutil.MigrateOptions{
+		ToPrefix:      *toPrefix,
+		Move:          *move,
+		Replace:       *replace,
+		BatchSize:     *batch,
+		KeysPerSecond: *rate,
+		Cursor:        *cursor,
+	}
+	// unset target flags default to the source connection
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["to-host"] {
+		*toHost = *fromHost
+	}
+	if !set["to-port"] {
+		*toPort = *fromPort
+	}
+	if !set["to-pass"] {
+		*toPass = *fromPass
+	}
+	if !set["to-db"] {
+		*toDB = *fromDB
+	}
+
+	if *toHost != *fromHost || *toPort != *fromPort || *toPass != *fromPass || *toDB != *fromDB {
+		target, err := redisutil.Dial(*toHost, *toPort, *toPass, *toDB, *toPrefix)
+		if err != nil {
+			os.Exit(1)
+		}
+		defer target.Close()
+		opts.Target = target
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	progress, err := source.MigratePrefix(ctx, opts)
+	if err != nil {
+		logger.StdError("redis prefix migration stopped: ", err)
+		fmt.Fprintf(os.Stderr, "resume with -cursor %d\n", progress.Cursor)
+		os.Exit(1)
+	}
+
+	fmt.Printf("scanned %d, copied %d, skipped %d\n", progress.Scanned, progress.Copied, progress.Skipped)
+}
@@ -0,0 +1,231 @@
+/*
+Command redisutil inspects the keys a service owns under its prefix.
+
+	redisutil [flags] ls [pattern]
+	redisutil [flags] get <key>
+	redisutil [flags] ttl <key>
+	redisutil [flags] memory <key>
+	redisutil [flags] top [n] [pattern]
+	redisutil [flags] del-pattern [-dry-run] [-no-prefix] <pattern>
+
+Keys and patterns are given without the prefix. Without a prefix del-pattern
+would act on the whole database, so it then requires -no-prefix. Connection flags default to
+the REDIS_HOST, REDIS_PORT, REDIS_PASSWORD, REDIS_DB and REDIS_PREFIX
+environment variables.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+func main() {
+	db, _ := strconv.Atoi(os.Getenv("REDIS_DB"))
+	host := flag.String("host", envOr("REDIS_HOST", "localhost"), "redis host")
+	port := flag.String("port", envOr("REDIS_PORT", "6379"), "redis port")
+	pass := flag.String("pass", os.Getenv("REDIS_PASSWORD"), "redis password")
+	dbIndex := flag.Int("db", db, "redis db")
+	prefix := flag.String("prefix", os.Getenv("REDIS_PREFIX"), "key prefix of the service")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	r, err := redisutil.Dial(*host, *port, *pass, *dbIndex, *prefix)
+	if err != nil {
+		os.Exit(1)
+	}
+	defer r.Close()
+
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "ls":
+		err = ls(r, argOr(args, 0, "*"))
+	case "get":
+		err = get(r, requireArg(args, 0, "key"))
+	case "ttl":
+		err = ttl(r, requireArg(args, 0, "key"))
+	case "memory":
+		err = memory(r, requireArg(args, 0, "key"))
+	case "top":
+		n, convErr := strconv.Atoi(argOr(args, 0, "10"))
+		if convErr != nil || n < 1 {
+			fail("top: n must be a positive number")
+		}
+		err = top(r, n, argOr(args, 1, "*"))
+	case "del-pattern":
+		err = delPattern(r, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(err.Error())
+	}
+}
+
+func ls(r *redisutil.Redis, pattern string) error {
+	keys, err := r.Keys(pattern)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+
+	return nil
+}
+
+func get(r *redisutil.Redis, key string) error {
+	value, err := r.Get(key)
+	if err != nil {
+		return err
+	}
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		// not JSON, print as stored
+		fmt.Println(value)
+		return nil
+	}
+
+	pretty, err := utils.PrettyJSON(data)
+	if err != nil {
+		return err
+	}
+	fmt.Println(pretty)
+
+	return nil
+}
+
+func ttl(r *redisutil.Redis, key string) error {
+	d, err := r.TTL(key)
+	if err != nil {
+		return err
+	}
+
+	switch d {
+	case redisutil.TTLMissing:
+		fmt.Println("missing")
+	case redisutil.TTLPersistent:
+		fmt.Println("no ttl")
+	default:
+		fmt.Println(d.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+func memory(r *redisutil.Redis, key string) error {
+	size, err := r.MemoryUsage(key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(size)
+	return nil
+}
+
+func top(r *redisutil.Redis, n int, pattern string) error {
+	keys, err := r.Keys(pattern)
+	if err != nil {
+		return err
+	}
+
+	type keySize struct {
+		key  string
+		size int64
+	}
+	sizes := make([]keySize, 0, len(keys))
+	for _, key := range keys {
+		size, err := r.MemoryUsage(key)
+		if err != nil {
+			// expired since the scan
+			continue
+		}
+		sizes = append(sizes, keySize{key, size})
+	}
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].size > sizes[j].size })
+	if len(sizes) > n {
+		sizes = sizes[:n]
+	}
+	for _, ks := range sizes {
+		fmt.Printf("%12d  %s\n", ks.size, ks.key)
+	}
+
+	return nil
+}
+
+func delPattern(r *redisutil.Redis, args []string) error {
+	fs := flag.NewFlagSet("del-pattern", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "list the keys without deleting them")
+	noPrefix := fs.Bool("no-prefix", false, "allow deleting when no prefix is set")
+	_ = fs.Parse(args)
+	pattern := requireArg(fs.Args(), 0, "pattern")
+
+	if r.Prefix == "" && !*noPrefix && !*dryRun {
+		fail("del-pattern: no prefix is set, pass -no-prefix to delete across the whole database")
+	}
+
+	if !*dryRun {
+		return r.DelPattern(pattern)
+	}
+
+	keys, err := r.Keys(pattern)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+	fmt.Printf("%d keys would be deleted\n", len(keys))
+
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: redisutil [flags] ls|get|ttl|memory|top|del-pattern [args]")
+	flag.PrintDefaults()
+}
+
+func fail(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(1)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func argOr(args []string, i int, fallback string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return fallback
+}
+
+func requireArg(args []string, i int, name string) string {
+	if i >= len(args) {
+		fail("missing " + name)
+	}
+	return args[i]
+}
@@ -5,5 +5,29 @@ import (
 )
 
 var (
-	ErrEmptyRedisKeyValue = errors.New("empty redisutil key or value")
+	ErrEmptyRedisKeyValue   = errors.New("empty redisutil key or value")
+	ErrInvalidResolution    = errors.New("invalid redisutil counter resolution")
+	ErrScriptNotFound       = errors.New("redisutil script not registered")
+	ErrTxRetriesExhausted   = errors.New("redisutil transaction retries exhausted")
+	ErrInvalidEncryptionKey = errors.New("invalid redisutil encryption key")
+	ErrDecryptFailed        = errors.New("redisutil failed to decrypt value")
+	ErrInvalidSemaphore     = errors.New("invalid redisutil semaphore name, limit or ttl")
+	ErrRedisNotConfigured   = errors.New("redisutil connection not configured")
+	ErrInvalidMigration     = errors.New("redisutil migration target overlaps the source")
+	ErrSchemaNotRegistered  = errors.New("redisutil schema not registered")
+	ErrWarmupFailed         = errors.New("cache warm-up failed")
+	ErrLoaderNotFound       = errors.New("cache warm-up loader not registered")
+	ErrFlagNotFound         = errors.New("feature flag not found")
+	ErrEmptyFlagName        = errors.New("empty feature flag name")
+	ErrInvalidRollout       = errors.New("feature flag rollout must be between 0 and 100")
+	ErrOTPSecretMissing     = errors.New("otp secret not configured")
+	ErrOTPCooldown          = errors.New("otp requested too soon")
+	ErrOTPExpired           = errors.New("otp expired or not issued")
+	ErrOTPInvalid           = errors.New("invalid otp")
+	ErrOTPTooManyAttempts   = errors.New("too many otp attempts")
+	ErrAPIKeyInvalid        = errors.New("invalid api key")
+	ErrQuotaExceeded        = errors.New("api key quota exceeded")
+	ErrInvalidLeaderLease   = errors.New("invalid redisutil leader election name or lease")
+	ErrOTPReplayed          = errors.New("otp already used")
+	ErrBucketRangeTooLarge  = errors.New("redisutil bucket range spans too many buckets")
 )
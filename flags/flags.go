@@ -0,0 +1,254 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+const (
+	flagsKey       = "flags"
+	flagsChannel   = "flags:changed"
+	reloadInterval = time.Minute
+)
+
+// Flag is a feature toggle definition.
+//
+// A flag is on for a user when it is enabled, targets the environment (or no
+// environment at all), does not deny the user and either allows the user
+// explicitly or puts the user in its Rollout percentage.
+type Flag struct {
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Enabled      bool      `json:"enabled"`
+	Rollout      int       `json:"rollout"`
+	Allow        []string  `json:"allow"`
+	Deny         []string  `json:"deny"`
+	Environments []string  `json:"environments"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Client evaluates flags stored in Redis for one environment. Definitions are
+// cached in-process and reloaded when another replica changes a flag.
+type Client struct {
+	redis *redisutil.Redis
+	env   string
+
+	mu     sync.RWMutex
+	flags  map[string]Flag
+	loaded bool
+	// generation counts invalidations, a load only marks the cache loaded if
+	// none happened while it was fetching
+	generation uint64
+}
+
+func NewClient(r *redisutil.Redis, env string) *Client {
+	return &Client{
+		redis: r,
+		env:   env,
+		flags: map[string]Flag{},
+	}
+}
+
+/*
+Watch keeps the in-process cache in sync until ctx is done. It subscribes to
+flag changes and reloads every definition on each change, plus once per
+minute in case a message was missed.
+*/
+func (c *Client) Watch(ctx context.Context) {
+	pubsub := c.redis.Subscribe(flagsChannel)
+	defer pubsub.Close()
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-messages:
+			c.Invalidate()
+		case <-ticker.C:
+			c.Invalidate()
+		}
+	}
+}
+
+// Invalidate drops the in-process cache, the next evaluation reloads it.
+func (c *Client) Invalidate() {
+	c.mu.Lock()
+	c.loaded = false
+	c.generation++
+	c.mu.Unlock()
+}
+
+// IsEnabled reports whether flag name is on for userID. Unknown flags and
+// Redis failures evaluate to false.
+func (c *Client) IsEnabled(name, userID string) bool {
+	flag, err := c.Get(name)
+	if err != nil {
+		return false
+	}
+
+	return flag.evaluate(c.env, userID)
+}
+
+// Get returns the definition of flag name.
+func (c *Client) Get(name string) (Flag, error) {
+	if err := c.load(); err != nil {
+		return Flag{}, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	flag, ok := c.flags[name]
+	if !ok {
+		return Flag{}, errutil.ErrFlagNotFound
+	}
+
+	return flag, nil
+}
+
+// List returns every flag definition.
+func (c *Client) List() ([]Flag, error) {
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	list := make([]Flag, 0, len(c.flags))
+	for _, flag := range c.flags {
+		list = append(list, flag)
+	}
+
+	return list, nil
+}
+
+// Save creates or replaces flag and tells every replica to reload.
+func (c *Client) Save(flag Flag) error {
+	if utils.IsEmpty(flag.Name) {
+		return errutil.ErrEmptyFlagName
+	}
+	if flag.Rollout < 0 || flag.Rollout > 100 {
+		return errutil.ErrInvalidRollout
+	}
+
+	flag.UpdatedAt = time.Now()
+	if err := c.redis.HSetStruct(flagsKey, flag.Name, flag); err != nil {
+		return err
+	}
+
+	return c.changed()
+}
+
+// Toggle flips the Enabled state of flag name and returns the new definition.
+// Concurrent toggles are serialized, so each of them flips the flag.
+func (c *Client) Toggle(name string) (Flag, error) {
+	flag := Flag{}
+	err := c.redis.Transaction(context.Background(), []string{flagsKey}, func(tx redisutil.Tx) error {
+		flag = Flag{}
+		if err := tx.HGetStruct(flagsKey, name, &flag); err != nil {
+			return err
+		}
+
+		flag.Enabled = !flag.Enabled
+		flag.UpdatedAt = time.Now()
+		tx.HSetStruct(flagsKey, name, flag)
+		return nil
+	})
+	if err != nil {
+		if err == redis.Nil {
+			return Flag{}, errutil.ErrFlagNotFound
+		}
+		return Flag{}, err
+	}
+
+	if err := c.changed(); err != nil {
+		return Flag{}, err
+	}
+
+	return flag, nil
+}
+
+// Delete removes flag name and tells every replica to reload.
+func (c *Client) Delete(name string) error {
+	if err := c.redis.HDel(flagsKey, name); err != nil {
+		return err
+	}
+
+	return c.changed()
+}
+
+func (c *Client) changed() error {
+	c.Invalidate()
+	return c.redis.Publish(flagsChannel, "changed")
+}
+
+func (c *Client) load() error {
+	c.mu.RLock()
+	loaded, generation := c.loaded, c.generation
+	c.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	all, err := c.redis.HGetAll(flagsKey)
+	if err != nil {
+		logger.Warn("failed to load feature flags: ", err)
+		return err
+	}
+
+	flags := make(map[string]Flag, len(all))
+	for name, raw := range all {
+		flag := Flag{}
+		if err := json.Unmarshal([]byte(raw), &flag); err != nil {
+			logger.Warn("invalid feature flag ", name, ": ", err)
+			continue
+		}
+		flags[name] = flag
+	}
+
+	c.mu.Lock()
+	c.flags = flags
+	c.loaded = c.generation == generation
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (f Flag) evaluate(env, userID string) bool {
+	if !f.Enabled {
+		return false
+	}
+	if len(f.Environments) > 0 && !utils.InArray(env, f.Environments) {
+		return false
+	}
+	if utils.InArray(userID, f.Deny) {
+		return false
+	}
+	if utils.InArray(userID, f.Allow) {
+		return true
+	}
+
+	return bucket(f.Name, userID) < f.Rollout
+}
+
+// bucket deterministically maps userID to 0-99 for flag name, so a user keeps
+// the same result while the rollout grows.
+func bucket(name, userID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + ":" + userID))
+	return int(h.Sum32() % 100)
+}
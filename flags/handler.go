@@ -0,0 +1,84 @@
+package flags
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+)
+
+type createFlagRequest struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Enabled      bool     `json:"enabled"`
+	Rollout      *int     `json:"rollout"`
+	Allow        []string `json:"allow"`
+	Deny         []string `json:"deny"`
+	Environments []string `json:"environments"`
+}
+
+// RegisterAdminRoutes adds the flag admin endpoints to g. Protect g with an
+// authentication middleware, the endpoints do not check the caller.
+//
+//	GET  /            list every flag
+//	POST /            create or replace a flag
+//	PUT  /:name/toggle toggle a flag on or off
+func RegisterAdminRoutes(g *echo.Group, c *Client) {
+	g.GET("", c.listHandler)
+	g.POST("", c.createHandler)
+	g.PUT("/:name/toggle", c.toggleHandler)
+}
+
+func (c *Client) listHandler(ctx echo.Context) error {
+	// admin reads bypass the cache so they always see the latest definitions
+	c.Invalidate()
+	list, err := c.List()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, list)
+}
+
+func (c *Client) createHandler(ctx echo.Context) error {
+	req := createFlagRequest{}
+	if err := ctx.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// flags without an explicit rollout are plain boolean toggles
+	rollout := 100
+	if req.Rollout != nil {
+		rollout = *req.Rollout
+	}
+
+	flag := Flag{
+		Name:         req.Name,
+		Description:  req.Description,
+		Enabled:      req.Enabled,
+		Rollout:      rollout,
+		Allow:        req.Allow,
+		Deny:         req.Deny,
+		Environments: req.Environments,
+	}
+	if err := c.Save(flag); err != nil {
+		if err == errutil.ErrEmptyFlagName || err == errutil.ErrInvalidRollout {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusCreated, flag)
+}
+
+func (c *Client) toggleHandler(ctx echo.Context) error {
+	flag, err := c.Toggle(ctx.Param("name"))
+	if err != nil {
+		if err == errutil.ErrFlagNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, flag)
+}
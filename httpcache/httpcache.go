@@ -0,0 +1,317 @@
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/vivasoft-ltd/golang-course-utils/apikey"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+const (
+	// HeaderCache tells whether a response was served from the cache.
+	HeaderCache = "X-Cache"
+
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
+
+	defaultTTL = time.Minute
+)
+
+// credentialHeaders identify the caller of a request, whose response may then
+// be meant for that caller only.
+var credentialHeaders = []string{echo.HeaderAuthorization, echo.HeaderCookie, apikey.HeaderAPIKey}
+
+// Config configures Middleware.
+type Config struct {
+	Skipper middleware.Skipper
+	Redis   *redisutil.Redis
+	// TTL of cached responses, one minute by default.
+	TTL time.Duration
+	// QueryParams are the query parameters that make up the cache key. Nil
+	// uses every parameter, an empty slice ignores the query string.
+	QueryParams []string
+	// VaryHeaders are request headers that make up the cache key, they are
+	// also sent in the Vary response header.
+	VaryHeaders []string
+	// Tags returns the invalidation tags of a response, see Purge.
+	Tags func(c echo.Context) []string
+}
+
+// entry is a cached response.
+type entry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	ETag   string      `json:"etag"`
+}
+
+// recorder buffers a response so that it can be cached and given an ETag
+// before being sent.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+/*
+Middleware caches the successful responses of GET and HEAD requests in Redis.
+Every response gets an ETag, and requests whose If-None-Match matches it are
+answered with 304. Requests with "Cache-Control: no-cache" skip the cached copy
+and refresh it, responses with "Cache-Control: no-store" or "private", or
+setting a cookie, are never cached. Only the headers set by the handler are
+cached.
+
+Requests carrying credentials, in the Authorization, Cookie or X-API-Key
+header, neither read the cache nor are cached, unless their response is
+"Cache-Control: public" or the header is one of VaryHeaders, which gives
+every caller its own entry.
+*/
+func Middleware(config Config) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Skipper(c) || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return next(c)
+			}
+
+			requestCacheControl := req.Header.Get(echo.HeaderCacheControl)
+			if strings.Contains(requestCacheControl, "no-store") {
+				return next(c)
+			}
+
+			key := cacheKey(req, config)
+			shared := !credentialed(req, config)
+			if shared && !strings.Contains(requestCacheControl, "no-cache") {
+				cached := entry{}
+				if err := config.Redis.GetStruct(key, &cached); err == nil {
+					return serve(c, cached, "HIT", config)
+				}
+			}
+
+			// the recorder keeps its own headers so that only those set by the
+			// handler get cached, not the request-scoped ones of other middleware
+			res := c.Response()
+			original := res.Writer
+			rec := &recorder{header: http.Header{}}
+			res.Writer = rec
+			err := next(c)
+			res.Writer = original
+
+			if err != nil {
+				// let the error handler write the response
+				if rec.status != 0 {
+					copyHeader(original.Header(), rec.header)
+					original.WriteHeader(rec.status)
+					_, _ = original.Write(rec.body.Bytes())
+				}
+				return err
+			}
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			fresh := entry{
+				Status: status,
+				Header: rec.header.Clone(),
+				Body:   rec.body.Bytes(),
+				ETag:   etag(rec.body.Bytes()),
+			}
+
+			public := strings.Contains(rec.header.Get(echo.HeaderCacheControl), "public")
+			if status == http.StatusOK && cacheable(rec.header) && (shared || public) {
+				var tags []string
+				if config.Tags != nil {
+					tags = config.Tags(c)
+				}
+				if err := config.Redis.SetWithTags(key, fresh, config.TTL, tags...); err != nil {
+					logger.Warn("failed to cache response of ", req.URL.Path, ": ", err)
+				}
+			}
+
+			return serve(c, fresh, "MISS", config)
+		}
+	}
+}
+
+// Purge deletes the cached responses stored under tags, typically after a
+// write changed the data they were built from.
+func Purge(r *redisutil.Redis, tags ...string) error {
+	return r.InvalidateTags(tags...)
+}
+
+/*
+PurgeOnWrite purges the tags returned by tags after every successful request
+that is not a GET or HEAD, so that writes invalidate the routes they affect.
+*/
+func PurgeOnWrite(r *redisutil.Redis, tags func(c echo.Context) []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := next(c); err != nil {
+				return err
+			}
+
+			method := c.Request().Method
+			status := c.Response().Status
+			if method == http.MethodGet || method == http.MethodHead || status >= http.StatusBadRequest {
+				return nil
+			}
+
+			if purge := tags(c); len(purge) > 0 {
+				if err := Purge(r, purge...); err != nil {
+					logger.Warn("failed to purge cached responses: ", err)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+func serve(c echo.Context, e entry, cacheStatus string, config Config) error {
+	res := c.Response()
+	// the handler response went to the recorder, the real one is still unsent
+	res.Committed = false
+
+	header := res.Header()
+	copyHeader(header, e.Header)
+	header.Set(headerETag, e.ETag)
+	header.Set(HeaderCache, cacheStatus)
+	if len(config.VaryHeaders) > 0 {
+		header.Set(echo.HeaderVary, strings.Join(config.VaryHeaders, ", "))
+	}
+
+	if e.Status == http.StatusOK && etagMatches(c.Request().Header.Get(headerIfNoneMatch), e.ETag) {
+		header.Del(echo.HeaderContentLength)
+		res.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	if c.Request().Method == http.MethodHead {
+		res.WriteHeader(e.Status)
+		return nil
+	}
+
+	res.WriteHeader(e.Status)
+	_, err := res.Write(e.Body)
+	return err
+}
+
+func cacheKey(req *http.Request, config Config) string {
+	var b strings.Builder
+	b.WriteString(req.Method + " " + req.URL.Path + "?")
+
+	query := req.URL.Query()
+	params := config.QueryParams
+	if params == nil {
+		for name := range query {
+			params = append(params, name)
+		}
+	}
+	sort.Strings(params)
+
+	selected := url.Values{}
+	for _, name := range params {
+		if values, ok := query[name]; ok {
+			selected[name] = values
+		}
+	}
+	b.WriteString(selected.Encode())
+
+	for _, name := range config.VaryHeaders {
+		b.WriteString("\n" + strings.ToLower(name) + ":" + req.Header.Get(name))
+	}
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return "httpcache:" + hex.EncodeToString(sum[:])
+}
+
+// credentialed reports whether req carries credentials that are not part of
+// its cache key.
+func credentialed(req *http.Request, config Config) bool {
+	for _, name := range credentialHeaders {
+		if req.Header.Get(name) == "" {
+			continue
+		}
+		varies := false
+		for _, vary := range config.VaryHeaders {
+			if strings.EqualFold(vary, name) {
+				varies = true
+			}
+		}
+		if !varies {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheable reports whether a response may be shared between users, which
+// rules out any response setting a cookie.
+func cacheable(header http.Header) bool {
+	if len(header.Values(echo.HeaderSetCookie)) > 0 {
+		return false
+	}
+	cacheControl := header.Get(echo.HeaderCacheControl)
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
+
+// copyHeader adds the headers of src to dst, keeping those dst already has.
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		if _, ok := dst[name]; !ok {
+			dst[name] = values
+		}
+	}
+}
+
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func etagMatches(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
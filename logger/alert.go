@@ -0,0 +1,424 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Alert is an entry delivered to the alert sinks.
+type Alert struct {
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Time    time.Time              `json:"time"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	// Repeated counts the identical alerts dropped since this one was last sent.
+	Repeated int `json:"repeated,omitempty"`
+}
+
+// AlertSink delivers batches of alerts, see SlackSink and WebhookSink.
+type AlertSink interface {
+	Name() string
+	Send(ctx context.Context, alerts []Alert) error
+}
+
+// AlertOptions configures an AlertHook. Zero sizes and durations take the
+// defaults of DefaultAlertOptions, zero MaxRetries, DedupWindow and RateLimit
+// disable them.
+type AlertOptions struct {
+	// Level is the least severe level alerted, Error when left to Panic, the
+	// zero value.
+	Level logrus.Level
+	// BatchSize and FlushInterval bound how long alerts wait to be sent.
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxRetries and RetryBackoff control redelivery of failed batches, the
+	// backoff doubling after each attempt.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// DedupWindow drops alerts identical to one sent within the window.
+	DedupWindow time.Duration
+	// RateLimit is the number of alerts each sink delivers per RatePeriod,
+	// the rest are dropped.
+	RateLimit  int
+	RatePeriod time.Duration
+	// QueueSize is the number of alerts waiting per sink before new ones are
+	// dropped.
+	QueueSize int
+	// FatalTimeout bounds the synchronous delivery of Fatal and Panic alerts.
+	FatalTimeout time.Duration
+}
+
+/*
+AlertHook is a logrus hook sending Error and more severe entries to alert
+sinks. Delivery is asynchronous: each sink has its own queue, batches, retries
+and rate limit, so a slow or failing sink never blocks logging nor the other
+sinks. Fatal and Panic entries are the exception, they are sent right away,
+bypassing deduplication and rate limits, since the process exits or panics
+once they are logged. Delivery failures are reported to stderr.
+
+Alerts carry the entry as the hooks installed before see it. EnableRedaction
+installs its hook ahead of the others, so alerts are redacted whatever the
+order both are enabled in.
+*/
+type AlertHook struct {
+	opts    AlertOptions
+	workers []*alertWorker
+
+	mu     sync.Mutex
+	seen   map[string]*dedupEntry
+	closed bool
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type dedupEntry struct {
+	sentAt     time.Time
+	suppressed int
+}
+
+type alertWorker struct {
+	sink  AlertSink
+	queue chan Alert
+	opts  AlertOptions
+
+	windowStart time.Time
+	sent        int
+	dropped     int
+}
+
+// DefaultAlertOptions batches up to 10 alerts for 5 seconds, retries 3 times
+// and sends each distinct message at most once every 5 minutes, with at most
+// 30 alerts per minute and sink.
+func DefaultAlertOptions() AlertOptions {
+	return AlertOptions{
+		Level:         logrus.ErrorLevel,
+		BatchSize:     10,
+		FlushInterval: 5 * time.Second,
+		MaxRetries:    3,
+		RetryBackoff:  time.Second,
+		DedupWindow:   5 * time.Minute,
+		RateLimit:     30,
+		RatePeriod:    time.Minute,
+		QueueSize:     1000,
+		FatalTimeout:  5 * time.Second,
+	}
+}
+
+func NewAlertHook(opts AlertOptions, sinks ...AlertSink) *AlertHook {
+	defaults := DefaultAlertOptions()
+	if opts.Level == logrus.PanicLevel {
+		opts.Level = defaults.Level
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaults.FlushInterval
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaults.RetryBackoff
+	}
+	if opts.RatePeriod <= 0 {
+		opts.RatePeriod = defaults.RatePeriod
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.FatalTimeout <= 0 {
+		opts.FatalTimeout = defaults.FatalTimeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &AlertHook{
+		opts:   opts,
+		seen:   map[string]*dedupEntry{},
+		cancel: cancel,
+	}
+
+	for _, sink := range sinks {
+		w := &alertWorker{sink: sink, queue: make(chan Alert, opts.QueueSize), opts: opts}
+		h.workers = append(h.workers, w)
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			w.run(ctx)
+		}()
+	}
+
+	return h
+}
+
+// EnableAlerts installs an AlertHook delivering to sinks on the standard logger.
+func EnableAlerts(opts AlertOptions, sinks ...AlertSink) *AlertHook {
+	h := NewAlertHook(opts, sinks...)
+	logger.AddHook(h)
+	return h
+}
+
+// EnableAlerts installs an AlertHook delivering to sinks on the CustomLogger.
+func (r *CustomLogger) EnableAlerts(opts AlertOptions, sinks ...AlertSink) *AlertHook {
+	h := NewAlertHook(opts, sinks...)
+	r.client.AddHook(h)
+	return h
+}
+
+func (h *AlertHook) Levels() []logrus.Level {
+	var levels []logrus.Level
+	for _, level := range logrus.AllLevels {
+		if level <= h.opts.Level {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+func (h *AlertHook) Fire(entry *logrus.Entry) error {
+	alert := Alert{
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Time:    entry.Time,
+		Fields:  alertFields(entry.Data),
+	}
+
+	if entry.Level <= logrus.FatalLevel {
+		h.deliverNow(alert)
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+	repeated, ok := h.dedup(entry.Level.String()+"|"+entry.Message, entry.Time)
+	if !ok {
+		return nil
+	}
+	alert.Repeated = repeated
+
+	for _, w := range h.workers {
+		select {
+		case w.queue <- alert:
+		default:
+			reportError("alert queue of ", w.sink.Name(), " is full, dropping: ", alert.Message)
+		}
+	}
+	return nil
+}
+
+// deliverNow sends alert to every sink in parallel and waits, at most
+// FatalTimeout, for the deliveries to finish.
+func (h *AlertHook) deliverNow(alert Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.opts.FatalTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, w := range h.workers {
+		wg.Add(1)
+		go func(w *alertWorker) {
+			defer wg.Done()
+			w.flush(ctx, []Alert{alert})
+		}(w)
+	}
+	wg.Wait()
+}
+
+/*
+Close stops accepting alerts and waits for the queued ones to be delivered.
+Deliveries still running when ctx is done are abandoned.
+*/
+func (h *AlertHook) Close(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		for _, w := range h.workers {
+			close(w.queue)
+		}
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		h.cancel()
+		return nil
+	case <-ctx.Done():
+		h.cancel()
+		return ctx.Err()
+	}
+}
+
+// dedup reports whether the alert keyed key should be sent and how many of its
+// duplicates were dropped since it last was. h.mu must be held.
+func (h *AlertHook) dedup(key string, now time.Time) (int, bool) {
+	if h.opts.DedupWindow <= 0 {
+		return 0, true
+	}
+
+	if e, ok := h.seen[key]; ok && now.Sub(e.sentAt) < h.opts.DedupWindow {
+		e.suppressed++
+		return 0, false
+	}
+
+	repeated := 0
+	if e, ok := h.seen[key]; ok {
+		repeated = e.suppressed
+	}
+	h.seen[key] = &dedupEntry{sentAt: now}
+
+	if len(h.seen) > 1000 {
+		for k, e := range h.seen {
+			if now.Sub(e.sentAt) >= h.opts.DedupWindow {
+				delete(h.seen, k)
+			}
+		}
+	}
+
+	return repeated, true
+}
+
+func (w *alertWorker) run(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []Alert
+	for {
+		select {
+		case alert, ok := <-w.queue:
+			if !ok {
+				w.flush(ctx, batch)
+				return
+			}
+			if !w.allow() {
+				continue
+			}
+			batch = append(batch, alert)
+			if len(batch) >= w.opts.BatchSize {
+				w.flush(ctx, batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			w.flush(ctx, batch)
+			batch = nil
+		}
+	}
+}
+
+// allow applies the rate limit of the sink, counting the dropped alerts.
+func (w *alertWorker) allow() bool {
+	if w.opts.RateLimit <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(w.windowStart) >= w.opts.RatePeriod {
+		if w.dropped > 0 {
+			reportError("alert rate limit of ", w.sink.Name(), " dropped ", w.dropped, " alerts")
+		}
+		w.windowStart = now
+		w.sent = 0
+		w.dropped = 0
+	}
+
+	if w.sent >= w.opts.RateLimit {
+		w.dropped++
+		return false
+	}
+	w.sent++
+	return true
+}
+
+func (w *alertWorker) flush(ctx context.Context, batch []Alert) {
+	if len(batch) == 0 {
+		return
+	}
+
+	backoff := w.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.sink.Send(ctx, batch)
+		if err == nil {
+			return
+		}
+		if attempt >= w.opts.MaxRetries {
+			reportError("failed to send ", len(batch), " alerts to ", w.sink.Name(), ": ", err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			reportError("abandoned ", len(batch), " alerts to ", w.sink.Name(), ": ", ctx.Err())
+			return
+		}
+	}
+}
+
+/*
+alertFields copies the entry fields, spreading the metadata passed to Error or
+ApiError into its own fields when it is a map or a struct.
+*/
+func alertFields(data logrus.Fields) map[string]interface{} {
+	f := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k == "metadata" && spreadMetadata(f, v) {
+			continue
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		f[k] = v
+	}
+	return f
+}
+
+func spreadMetadata(f map[string]interface{}, metaData interface{}) bool {
+	if metaData == nil {
+		return false
+	}
+	switch reflect.Indirect(reflect.ValueOf(metaData)).Kind() {
+	case reflect.Map, reflect.Struct:
+	default:
+		return false
+	}
+
+	encoded, err := json.Marshal(metaData)
+	if err != nil {
+		return false
+	}
+	spread := map[string]interface{}{}
+	if err := json.Unmarshal(encoded, &spread); err != nil {
+		return false
+	}
+
+	for k, v := range spread {
+		f[k] = v
+	}
+	return true
+}
+
+// formatField renders a field value for sinks that only take text.
+func formatField(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		if encoded, err := json.Marshal(value); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprint(v)
+}
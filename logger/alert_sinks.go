@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const defaultSinkTimeout = 10 * time.Second
+
+// SlackSink posts alerts to a Slack incoming webhook, one message per batch
+// with an attachment per alert.
+type SlackSink struct {
+	WebhookURL string
+	// Channel and Username override the webhook defaults when set.
+	Channel  string
+	Username string
+	// Client sends the requests, one with a 10 second timeout by default.
+	Client *http.Client
+}
+
+// WebhookSink posts alerts as JSON, {"alerts": [...]}, to any endpoint.
+type WebhookSink struct {
+	URL    string
+	Header http.Header
+	// Client sends the requests, one with a 10 second timeout by default.
+	Client *http.Client
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Title  string       `json:"title"`
+	Fields []slackField `json:"fields,omitempty"`
+	Footer string       `json:"footer,omitempty"`
+	Ts     int64        `json:"ts"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (s *SlackSink) Name() string {
+	return "slack"
+}
+
+func (s *SlackSink) Send(ctx context.Context, alerts []Alert) error {
+	msg := slackMessage{
+		Text:     fmt.Sprintf("%d alert(s)", len(alerts)),
+		Channel:  s.Channel,
+		Username: s.Username,
+	}
+
+	for _, alert := range alerts {
+		attachment := slackAttachment{
+			Color: "danger",
+			Title: alert.Level + ": " + alert.Message,
+			Ts:    alert.Time.Unix(),
+		}
+		if alert.Repeated > 0 {
+			attachment.Footer = fmt.Sprintf("repeated %d more times", alert.Repeated)
+		}
+
+		names := make([]string, 0, len(alert.Fields))
+		for name := range alert.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := formatField(alert.Fields[name])
+			attachment.Fields = append(attachment.Fields, slackField{Title: name, Value: value, Short: len(value) <= 40})
+		}
+
+		msg.Attachments = append(msg.Attachments, attachment)
+	}
+
+	return postJSON(ctx, s.Client, s.WebhookURL, nil, msg)
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook " + s.URL
+}
+
+func (s *WebhookSink) Send(ctx context.Context, alerts []Alert) error {
+	return postJSON(ctx, s.Client, s.URL, s.Header, map[string]interface{}{"alerts": alerts})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = &http.Client{Timeout: defaultSinkTimeout}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s responded %d: %s", url, res.StatusCode, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
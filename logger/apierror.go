@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces the values hidden by ApiError.
+const Redacted = "[REDACTED]"
+
+// ApiErrorOptions configures what ApiError logs of a request and response.
+type ApiErrorOptions struct {
+	// MaxBodySize truncates logged bodies to this many bytes, 0 disables bodies.
+	MaxBodySize int
+	// RedactHeaders are header names whose values are hidden, case-insensitive.
+	RedactHeaders []string
+	// RedactBodyFields are JSON field names whose values are hidden at any
+	// depth, case-insensitive.
+	RedactBodyFields []string
+}
+
+var apiErrorOptions = DefaultApiErrorOptions()
+
+// DefaultApiErrorOptions logs up to 4KB of each body and hides credentials.
+func DefaultApiErrorOptions() ApiErrorOptions {
+	return ApiErrorOptions{
+		MaxBodySize: 4096,
+		RedactHeaders: []string{
+			"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key",
+		},
+		RedactBodyFields: []string{
+			"password", "secret", "token", "access_token", "refresh_token", "api_key",
+		},
+	}
+}
+
+// SetApiErrorOptions configures ApiError on the standard logger.
+func SetApiErrorOptions(opts ApiErrorOptions) {
+	apiErrorOptions = opts
+}
+
+// SetApiErrorOptions configures ApiError on the CustomLogger.
+func (r *CustomLogger) SetApiErrorOptions(opts ApiErrorOptions) {
+	r.apiOptions = &opts
+}
+
+/*
+apiErrorFields flattens rs and metaData into the fields of a single entry:
+method, url, status, latency, headers and bodies, redacted and truncated as
+opts says, so that a failed call can be searched by any of them.
+*/
+func apiErrorFields(rs RequestResponseMap, metaData interface{}, opts ApiErrorOptions) logrus.Fields {
+	f := logrus.Fields{}
+
+	req := rs.Req
+	if req == nil && rs.Res != nil {
+		req = rs.Res.Request
+	}
+	if req != nil {
+		f["http_method"] = req.Method
+		if req.URL != nil {
+			f["http_url"] = req.URL.String()
+		}
+		f["request_headers"] = redactHeaders(req.Header, opts.RedactHeaders)
+	}
+	if rs.Res != nil {
+		f["http_status"] = rs.Res.StatusCode
+		f["response_headers"] = redactHeaders(rs.Res.Header, opts.RedactHeaders)
+	}
+	if rs.Latency > 0 {
+		f["latency_ms"] = rs.Latency.Milliseconds()
+	}
+
+	if opts.MaxBodySize > 0 {
+		if rs.ReqBody != nil {
+			f["request_body"] = formatBody(rs.ReqBody, opts)
+		}
+		if rs.ResBody != nil {
+			f["response_body"] = formatBody(rs.ResBody, opts)
+		}
+	}
+
+	if metaData != nil {
+		f["metadata"] = metaData
+	}
+
+	return f
+}
+
+func redactHeaders(header http.Header, redact []string) map[string]string {
+	out := make(map[string]string, len(header))
+	for name, values := range header {
+		if containsFold(redact, name) {
+			out[name] = Redacted
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+// formatBody renders body as JSON when it can, with the redacted fields
+// hidden, and truncates it to opts.MaxBodySize.
+func formatBody(body interface{}, opts ApiErrorOptions) string {
+	var raw []byte
+	switch b := body.(type) {
+	case []byte:
+		raw = b
+	case string:
+		raw = []byte(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return truncate(err.Error(), opts.MaxBodySize)
+		}
+		raw = encoded
+	}
+
+	var decoded interface{}
+	if len(opts.RedactBodyFields) > 0 && json.Unmarshal(raw, &decoded) == nil {
+		if encoded, err := json.Marshal(redactValue(decoded, opts.RedactBodyFields)); err == nil {
+			raw = encoded
+		}
+	}
+
+	return truncate(string(raw), opts.MaxBodySize)
+}
+
+func redactValue(v interface{}, redact []string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, nested := range value {
+			if containsFold(redact, k) {
+				value[k] = Redacted
+				continue
+			}
+			value[k] = redactValue(nested, redact)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = redactValue(nested, redact)
+		}
+	}
+	return v
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "...(truncated)"
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
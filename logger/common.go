@@ -14,17 +14,57 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// NewFileLoggerClient logs to stdout and to filePath, rotated with
+// DefaultRotateOptions, so rotated files are never deleted.
 func NewFileLoggerClient(filePath string) *CustomLogger {
-	logFile, err := openLogFile(filePath)
+	return NewRotatingFileLoggerClient(filePath, DefaultRotateOptions())
+}
+
+// NewRotatingFileLoggerClient logs to stdout and to filePath, rotated with opts.
+// Close the returned logger once it is replaced to release the file and stop
+// watching SIGHUP.
+func NewRotatingFileLoggerClient(filePath string, opts RotateOptions) *CustomLogger {
+	logFile, err := NewRotatingWriter(filePath, opts)
 	if err != nil {
 		return nil
 	}
-	logger = log.New()
+	logger = inheritLogger(logger)
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
 	logger.SetOutput(multiWriter)
 	return &CustomLogger{
 		client: logger,
+		closer: logFile,
+	}
+}
+
+// Close closes the log file of a file logger. Entries logged afterwards only
+// go to stdout.
+func (r *CustomLogger) Close() error {
+	if r.closer == nil {
+		return nil
 	}
+	r.client.SetOutput(os.Stdout)
+	err := r.closer.Close()
+	r.closer = nil
+	return err
+}
+
+// inheritLogger returns a new logger with the level, formatter and hooks of
+// previous, so that replacing the standard logger keeps what was enabled on it,
+// such as redaction.
+func inheritLogger(previous *log.Logger) *log.Logger {
+	client := log.New()
+	client.SetLevel(previous.GetLevel())
+	client.SetFormatter(previous.Formatter)
+	client.SetReportCaller(previous.ReportCaller)
+
+	hooks := log.LevelHooks{}
+	for level, levelHooks := range previous.Hooks {
+		hooks[level] = append([]log.Hook(nil), levelHooks...)
+	}
+	client.ReplaceHooks(hooks)
+
+	return client
 }
 
 func (r *CustomLogger) SetLogLevel(level logrus.Level) {
@@ -102,28 +142,40 @@ func (r *CustomLogger) StdError(args ...interface{}) {
 	}
 }
 
-// Error logs a message at level Error on the CustomLogger and sends alert to slack
+// Error logs a message at level Error on the CustomLogger and sends alerts to
+// the sinks enabled with EnableAlerts.
 //
 // if 1 item in args then there will be no metadata
 //
-// if multiple items in args then 1st item will be treated as metadata and rest items will go for args
+// if multiple items in args then 1st item will be treated as metadata, logged in the
+// metadata field and sent as alert fields, and rest items will go for args
 func (r *CustomLogger) Error(args ...interface{}) {
+	var metaData interface{}
 	if len(args) > 1 {
+		metaData = args[0]
 		args = args[1:]
 	}
 
 	if r.client.Level >= logrus.ErrorLevel {
 		entry := r.client.WithFields(logrus.Fields{})
 		entry.Data["file"] = fileInfo(2)
+		if metaData != nil {
+			entry.Data["metadata"] = metaData
+		}
 		entry.Error(args...)
-
 	}
 }
 
-// Error logs a message at level Error on the CustomLogger. with res data and metaData
+// ApiError logs a failed outbound call at level Error on the CustomLogger as a
+// single entry with the request, response and metadata fields, see ApiErrorOptions.
 func (r *CustomLogger) ApiError(rs RequestResponseMap, metaData interface{}, args ...interface{}) {
 	if r.client.Level >= logrus.ErrorLevel {
-		entry := logger.WithFields(logrus.Fields{})
+		opts := apiErrorOptions
+		if r.apiOptions != nil {
+			opts = *r.apiOptions
+		}
+
+		entry := r.client.WithFields(apiErrorFields(rs, metaData, opts))
 		entry.Data["file"] = fileInfo(2)
 		entry.Error(args...)
 	}
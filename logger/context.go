@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// contextFieldsKey stores the fields added by ContextWithFields.
+type contextFieldsKey struct{}
+
+// ContextLogger logs with the fields stored in a context, see WithContext.
+type ContextLogger struct {
+	client *logrus.Logger
+	ctx    context.Context
+}
+
+/*
+ContextWithFields returns a copy of ctx carrying f on top of the fields already
+stored in it. Every entry logged through WithContext or the *Ctx functions
+with that context gets these fields, so request IDs, user IDs and trace IDs
+only have to be set once.
+*/
+func ContextWithFields(ctx context.Context, f map[string]interface{}) context.Context {
+	merged := FieldsFromContext(ctx)
+	for k, v := range f {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, contextFieldsKey{}, merged)
+}
+
+// FieldsFromContext returns a copy of the fields stored in ctx.
+func FieldsFromContext(ctx context.Context) map[string]interface{} {
+	f := map[string]interface{}{}
+	if ctx == nil {
+		return f
+	}
+	if stored, ok := ctx.Value(contextFieldsKey{}).(map[string]interface{}); ok {
+		for k, v := range stored {
+			f[k] = v
+		}
+	}
+	return f
+}
+
+// WithContext returns a logger adding the fields of ctx to the standard logger
+// entries.
+func WithContext(ctx context.Context) *ContextLogger {
+	return &ContextLogger{client: logger, ctx: ctx}
+}
+
+// WithContext returns a logger adding the fields of ctx to the CustomLogger
+// entries.
+func (r *CustomLogger) WithContext(ctx context.Context) *ContextLogger {
+	return &ContextLogger{client: r.client, ctx: ctx}
+}
+
+// DebugCtx logs a message at level Debug on the standard logger with the fields of ctx.
+func DebugCtx(ctx context.Context, args ...interface{}) {
+	if logger.Level >= logrus.DebugLevel {
+		contextEntry(logger, ctx, nil).Debug(args...)
+	}
+}
+
+// InfoCtx logs a message at level Info on the standard logger with the fields of ctx.
+func InfoCtx(ctx context.Context, args ...interface{}) {
+	if logger.Level >= logrus.InfoLevel {
+		entry := contextEntry(logger, ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Info(args...)
+	}
+}
+
+// WarnCtx logs a message at level Warn on the standard logger with the fields of ctx.
+func WarnCtx(ctx context.Context, args ...interface{}) {
+	if logger.Level >= logrus.WarnLevel {
+		entry := contextEntry(logger, ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Warn(args...)
+	}
+}
+
+// ErrorCtx logs a message at level Error on the standard logger with the fields
+// of ctx. Unlike Error, every arg is logged.
+func ErrorCtx(ctx context.Context, args ...interface{}) {
+	if logger.Level >= logrus.ErrorLevel {
+		entry := contextEntry(logger, ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Error(args...)
+	}
+}
+
+// DebugCtx logs a message at level Debug on the CustomLogger with the fields of ctx.
+func (r *CustomLogger) DebugCtx(ctx context.Context, args ...interface{}) {
+	if r.client.Level >= logrus.DebugLevel {
+		contextEntry(r.client, ctx, nil).Debug(args...)
+	}
+}
+
+// InfoCtx logs a message at level Info on the CustomLogger with the fields of ctx.
+func (r *CustomLogger) InfoCtx(ctx context.Context, args ...interface{}) {
+	if r.client.Level >= logrus.InfoLevel {
+		entry := contextEntry(r.client, ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Info(args...)
+	}
+}
+
+// WarnCtx logs a message at level Warn on the CustomLogger with the fields of ctx.
+func (r *CustomLogger) WarnCtx(ctx context.Context, args ...interface{}) {
+	if r.client.Level >= logrus.WarnLevel {
+		entry := contextEntry(r.client, ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Warn(args...)
+	}
+}
+
+// ErrorCtx logs a message at level Error on the CustomLogger with the fields of
+// ctx. Unlike Error, every arg is logged.
+func (r *CustomLogger) ErrorCtx(ctx context.Context, args ...interface{}) {
+	if r.client.Level >= logrus.ErrorLevel {
+		entry := contextEntry(r.client, ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Error(args...)
+	}
+}
+
+// Debug logs a message at level Debug with the fields of the context.
+func (r *ContextLogger) Debug(args ...interface{}) {
+	if r.client.Level >= logrus.DebugLevel {
+		contextEntry(r.client, r.ctx, nil).Debug(args...)
+	}
+}
+
+// DebugWithFields logs a message with fields at level Debug with the fields of the context.
+func (r *ContextLogger) DebugWithFields(l interface{}, f map[string]interface{}) {
+	if r.client.Level >= logrus.DebugLevel {
+		contextEntry(r.client, r.ctx, f).Debug(l)
+	}
+}
+
+// Info logs a message at level Info with the fields of the context.
+func (r *ContextLogger) Info(args ...interface{}) {
+	if r.client.Level >= logrus.InfoLevel {
+		entry := contextEntry(r.client, r.ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Info(args...)
+	}
+}
+
+// InfoWithFields logs a message with fields at level Info with the fields of the context.
+func (r *ContextLogger) InfoWithFields(l interface{}, f map[string]interface{}) {
+	if r.client.Level >= logrus.InfoLevel {
+		contextEntry(r.client, r.ctx, f).Info(l)
+	}
+}
+
+// Warn logs a message at level Warn with the fields of the context.
+func (r *ContextLogger) Warn(args ...interface{}) {
+	if r.client.Level >= logrus.WarnLevel {
+		entry := contextEntry(r.client, r.ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Warn(args...)
+	}
+}
+
+// WarnWithFields logs a message with fields at level Warn with the fields of the context.
+func (r *ContextLogger) WarnWithFields(l interface{}, f map[string]interface{}) {
+	if r.client.Level >= logrus.WarnLevel {
+		entry := contextEntry(r.client, r.ctx, f)
+		entry.Data["file"] = fileInfo(2)
+		entry.Warn(l)
+	}
+}
+
+// Error logs a message at level Error with the fields of the context. Unlike
+// the package level Error, every arg is logged.
+func (r *ContextLogger) Error(args ...interface{}) {
+	if r.client.Level >= logrus.ErrorLevel {
+		entry := contextEntry(r.client, r.ctx, nil)
+		entry.Data["file"] = fileInfo(2)
+		entry.Error(args...)
+	}
+}
+
+// ErrorWithFields logs a message with fields at level Error with the fields of the context.
+func (r *ContextLogger) ErrorWithFields(l interface{}, f map[string]interface{}) {
+	if r.client.Level >= logrus.ErrorLevel {
+		entry := contextEntry(r.client, r.ctx, f)
+		entry.Data["file"] = fileInfo(2)
+		entry.Error(l)
+	}
+}
+
+// contextEntry builds an entry with the fields of ctx, overridden by f.
+func contextEntry(client *logrus.Logger, ctx context.Context, f map[string]interface{}) *logrus.Entry {
+	data := FieldsFromContext(ctx)
+	for k, v := range f {
+		data[k] = v
+	}
+
+	entry := client.WithFields(logrus.Fields(data))
+	if ctx != nil {
+		entry = entry.WithContext(ctx)
+	}
+	return entry
+}
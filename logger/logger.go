@@ -88,30 +88,37 @@ func StdError(args ...interface{}) {
 	}
 }
 
-// Error logs a message at level Error on the standard logger and sends alert to slack.
+// Error logs a message at level Error on the standard logger and sends alerts
+// to the sinks enabled with EnableAlerts.
 //
 // if 1 item in args then there will be no metadata
 //
-// if multiple items in args then 1st item will be treated as metadata and rest items will go for args
+// if multiple items in args then 1st item will be treated as metadata, logged in the
+// metadata field and sent as alert fields, and rest items will go for args
 func Error(args ...interface{}) {
+	var metaData interface{}
 	if len(args) > 1 {
+		metaData = args[0]
 		args = args[1:]
 	}
 
 	if logger.Level >= logrus.ErrorLevel {
 		entry := logger.WithFields(logrus.Fields{})
 		entry.Data["file"] = fileInfo(2)
+		if metaData != nil {
+			entry.Data["metadata"] = metaData
+		}
 		entry.Error(args...)
 	}
 }
 
-// Error logs a message at level Error on the standard logger with request, response and metadata
+// ApiError logs a failed outbound call at level Error on the standard logger as
+// a single entry with the request, response and metadata fields, see ApiErrorOptions.
 func ApiError(rs RequestResponseMap, metaData interface{}, args ...interface{}) {
 	if logger.Level >= logrus.ErrorLevel {
-		entry := logger.WithFields(logrus.Fields{})
+		entry := logger.WithFields(apiErrorFields(rs, metaData, apiErrorOptions))
 		entry.Data["file"] = fileInfo(2)
 		entry.Error(args...)
-
 	}
 }
 
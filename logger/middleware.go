@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FieldRequestID is the field holding the request ID set by RequestIDMiddleware.
+const FieldRequestID = "request_id"
+
+/*
+RequestIDMiddleware seeds the request context with a request ID, taken from
+the X-Request-ID header or generated, so that WithContext(c.Request().Context())
+tags every entry of a request with it. The ID is echoed in the response header.
+*/
+func RequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if id == "" {
+				id = newRequestID()
+			}
+
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+			ctx := ContextWithFields(req.Context(), map[string]interface{}{FieldRequestID: id})
+			c.SetRequest(req.WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+// RequestIDFromContext returns the request ID stored by RequestIDMiddleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := FieldsFromContext(ctx)[FieldRequestID].(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
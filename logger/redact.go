@@ -0,0 +1,250 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactionRule masks the parts of string values matching Pattern. Validate,
+// when set, filters out false positives.
+type RedactionRule struct {
+	Name     string
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+// RedactionOptions configures a RedactionHook.
+type RedactionOptions struct {
+	// Keys are field names whose whole value is masked, case-insensitive and at
+	// any depth of maps and structs.
+	Keys []string
+	// Rules mask matching parts of string values, applied in order.
+	Rules []RedactionRule
+	// Salt keys the mask hashes. It must be kept secret: anyone knowing it can
+	// find masked emails or phone numbers back by hashing candidates. When
+	// empty a random salt is used, so hashes only correlate within a process.
+	Salt string
+}
+
+var (
+	RuleJWT = RedactionRule{
+		Name:    "jwt",
+		Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	}
+	RuleEmail = RedactionRule{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	// RulePAN masks card numbers, only those passing the Luhn check.
+	RulePAN = RedactionRule{
+		Name:     "pan",
+		Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Validate: luhnValid,
+	}
+	// RulePhone masks international numbers, starting with a country code, and
+	// Bangladeshi mobile numbers, so that timestamps, IDs and amounts are not.
+	RulePhone = RedactionRule{
+		Name:    "phone",
+		Pattern: regexp.MustCompile(`(?:\+\d{1,3}[\s-]?\d{2,4}[\s-]?\d{3,4}[\s-]?\d{3,4}|\b01[3-9]\d{2}[\s-]?\d{6})\b`),
+	}
+)
+
+// RedactionHook is a logrus hook masking sensitive data in entry fields and
+// messages before they are written.
+type RedactionHook struct {
+	keys  []string
+	rules []RedactionRule
+	salt  []byte
+}
+
+// DefaultRedactionOptions masks credentials, card and NID fields, emails,
+// phone numbers, card numbers and JWTs.
+func DefaultRedactionOptions() RedactionOptions {
+	return RedactionOptions{
+		Keys: []string{
+			"password", "passwd", "secret", "token", "access_token", "refresh_token",
+			"api_key", "apikey", "authorization", "cookie",
+			"card_number", "pan", "cvv", "pin", "nid", "nid_number",
+		},
+		Rules: []RedactionRule{RuleJWT, RuleEmail, RulePAN, RulePhone},
+	}
+}
+
+func NewRedactionHook(opts RedactionOptions) *RedactionHook {
+	salt := []byte(opts.Salt)
+	if len(salt) == 0 {
+		reportError("redaction salt is empty, masks will not correlate across processes")
+		salt = make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			reportError("failed to generate a redaction salt: ", err)
+		}
+	}
+
+	return &RedactionHook{keys: opts.Keys, rules: opts.Rules, salt: salt}
+}
+
+// EnableRedaction installs a RedactionHook on the standard logger, ahead of the
+// hooks already installed so that none of them, alerts included, sees the
+// unredacted entries.
+func EnableRedaction(opts RedactionOptions) {
+	addHookFirst(logger, NewRedactionHook(opts))
+}
+
+// EnableRedaction installs a RedactionHook on the CustomLogger, ahead of the
+// hooks already installed.
+func (r *CustomLogger) EnableRedaction(opts RedactionOptions) {
+	addHookFirst(r.client, NewRedactionHook(opts))
+}
+
+// addHookFirst installs hook so that it fires before the hooks of client.
+func addHookFirst(client *logrus.Logger, hook logrus.Hook) {
+	hooks := logrus.LevelHooks{}
+	hooks.Add(hook)
+	for _, level := range logrus.AllLevels {
+		hooks[level] = append(hooks[level], client.Hooks[level]...)
+	}
+	client.ReplaceHooks(hooks)
+}
+
+func (h *RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+/*
+Fire masks entry in place. Masks are "[REDACTED:<rule>:<hash>]" where the hash
+only depends on the value and the salt, so the same email or token can still be
+correlated across entries. Nested values are copied, never modified, as they
+may belong to the caller.
+*/
+func (h *RedactionHook) Fire(entry *logrus.Entry) error {
+	for k, v := range entry.Data {
+		if containsFold(h.keys, k) {
+			entry.Data[k] = h.mask("key", fmt.Sprintf("%v", v))
+			continue
+		}
+		entry.Data[k] = h.redact(v)
+	}
+	entry.Message = h.redactString(entry.Message)
+	return nil
+}
+
+func (h *RedactionHook) redact(v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return h.redactString(value)
+	case []byte:
+		return h.redactString(string(value))
+	case error:
+		return h.redactString(value.Error())
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+		// walk composites through their JSON form, which also honours json tags
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return h.redactString(fmt.Sprintf("%v", v))
+		}
+		decoded, ok := decodeJSON(encoded)
+		if !ok {
+			return v
+		}
+		return h.redactDecoded(decoded)
+	}
+
+	return v
+}
+
+// redactDecoded masks a value decoded from JSON, in place.
+func (h *RedactionHook) redactDecoded(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, nested := range value {
+			if containsFold(h.keys, k) {
+				value[k] = h.mask("key", fmt.Sprintf("%v", nested))
+				continue
+			}
+			value[k] = h.redactDecoded(nested)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = h.redactDecoded(nested)
+		}
+	case string:
+		return h.redactString(value)
+	}
+	return v
+}
+
+func (h *RedactionHook) redactString(s string) string {
+	// JSON bodies, such as those logged by ApiError, get their keys masked too
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if decoded, ok := decodeJSON([]byte(trimmed)); ok {
+			if encoded, err := json.Marshal(h.redactDecoded(decoded)); err == nil {
+				return string(encoded)
+			}
+		}
+	}
+
+	for _, rule := range h.rules {
+		s = rule.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.Validate != nil && !rule.Validate(match) {
+				return match
+			}
+			return h.mask(rule.Name, match)
+		})
+	}
+	return s
+}
+
+func (h *RedactionHook) mask(name, value string) string {
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(value))
+	return "[REDACTED:" + name + ":" + hex.EncodeToString(mac.Sum(nil)[:8]) + "]"
+}
+
+func decodeJSON(b []byte) (interface{}, bool) {
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil || decoder.More() {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, count := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		count++
+	}
+	return count >= 13 && count <= 19 && sum%10 == 0
+}
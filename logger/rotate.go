@@ -0,0 +1,315 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions configures a RotatingWriter. Zero values disable the matching
+// rotation or retention rule.
+type RotateOptions struct {
+	// MaxSize rotates the file before it grows past this many bytes.
+	MaxSize int64
+	// Interval rotates the file when a new interval starts, intervals being
+	// aligned on UTC (24h rotates at UTC midnight).
+	Interval time.Duration
+	// Compress gzips rotated files.
+	Compress bool
+	// MaxAge deletes rotated files older than this.
+	MaxAge time.Duration
+	// MaxBackups keeps at most this many rotated files.
+	MaxBackups int
+}
+
+// DefaultRotateOptions rotates daily or at 100MB and compresses, keeping every
+// rotated file. Set MaxAge or MaxBackups to delete old ones.
+func DefaultRotateOptions() RotateOptions {
+	return RotateOptions{
+		MaxSize:  100 << 20,
+		Interval: 24 * time.Hour,
+		Compress: true,
+	}
+}
+
+/*
+RotatingWriter is an io.Writer appending to a file that it rotates by size and
+time. Rotated files are renamed to "<name>-<time><ext>", then compressed and
+pruned in the background. It reopens the file on SIGHUP so that an external
+logrotate can move it away. It is safe for concurrent use, and since it cannot
+log its own failures it reports them to stderr.
+*/
+type RotatingWriter struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+
+	// millMu serializes compression and pruning of rotated files
+	millMu  sync.Mutex
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+func NewRotatingWriter(path string, opts RotateOptions) (*RotatingWriter, error) {
+	w := &RotatingWriter{
+		path:    path,
+		opts:    opts,
+		signals: make(chan os.Signal, 1),
+		done:    make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	signal.Notify(w.signals, syscall.SIGHUP)
+	go w.watchSignals()
+
+	return w, nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.size > 0 && w.due(int64(len(p)), time.Now()) {
+		if err := w.rotate(); err != nil {
+			reportError("failed to rotate ", w.path, ": ", err)
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file now.
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Reopen closes and reopens the file, which is what SIGHUP triggers.
+func (w *RotatingWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.close(); err != nil {
+		reportError("failed to close ", w.path, ": ", err)
+	}
+	return w.open()
+}
+
+// Close stops watching SIGHUP and closes the file.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	default:
+		signal.Stop(w.signals)
+		close(w.done)
+	}
+	return w.close()
+}
+
+func (w *RotatingWriter) due(n int64, now time.Time) bool {
+	if w.opts.MaxSize > 0 && w.size+n > w.opts.MaxSize {
+		return true
+	}
+	return w.opts.Interval > 0 && now.Truncate(w.opts.Interval).After(w.period)
+}
+
+func (w *RotatingWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := openLogFile(w.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	// an existing file belongs to the interval it was last written in
+	w.period = info.ModTime()
+	if w.size == 0 {
+		w.period = time.Now()
+	}
+	if w.opts.Interval > 0 {
+		w.period = w.period.Truncate(w.opts.Interval)
+	}
+	return nil
+}
+
+func (w *RotatingWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *RotatingWriter) rotate() error {
+	if err := w.close(); err != nil {
+		reportError("failed to close ", w.path, ": ", err)
+	}
+
+	ext := filepath.Ext(w.path)
+	backup := strings.TrimSuffix(w.path, ext) + "-" + time.Now().UTC().Format(backupTimeFormat) + ext
+	if err := os.Rename(w.path, backup); err != nil && !os.IsNotExist(err) {
+		// keep writing to the old file rather than losing entries
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	go w.mill()
+	return nil
+}
+
+// mill compresses rotated files and deletes those past retention.
+func (w *RotatingWriter) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	backups, err := w.backups()
+	if err != nil {
+		reportError("failed to list rotated files of ", w.path, ": ", err)
+		return
+	}
+
+	now := time.Now()
+	for i, b := range backups {
+		expired := w.opts.MaxAge > 0 && now.Sub(b.rotatedAt) > w.opts.MaxAge
+		if expired || (w.opts.MaxBackups > 0 && i >= w.opts.MaxBackups) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				reportError("failed to remove ", b.path, ": ", err)
+			}
+			continue
+		}
+
+		if w.opts.Compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				reportError("failed to compress ", b.path, ": ", err)
+			}
+		}
+	}
+}
+
+type backupFile struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// backups returns the rotated files, newest first.
+func (w *RotatingWriter) backups() ([]backupFile, error) {
+	ext := filepath.Ext(w.path)
+	prefix := filepath.Base(strings.TrimSuffix(w.path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backupFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		rotatedAt, err := time.Parse(backupTimeFormat, strings.TrimPrefix(stamp, prefix))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(filepath.Dir(w.path), name), rotatedAt: rotatedAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotatedAt.After(backups[j].rotatedAt)
+	})
+	return backups, nil
+}
+
+func (w *RotatingWriter) watchSignals() {
+	for {
+		select {
+		case <-w.signals:
+			if err := w.Reopen(); err != nil {
+				reportError("failed to reopen ", w.path, ": ", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func reportError(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, "logger: "+fmt.Sprint(args...))
+}
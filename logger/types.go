@@ -1,7 +1,9 @@
 package logger
 
 import (
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,12 +13,18 @@ type fields logrus.Fields
 
 // CustomLogger wraps logrus.Logger and provides additional functionality
 type CustomLogger struct {
-	client *logrus.Logger
+	client     *logrus.Logger
+	apiOptions *ApiErrorOptions
+	// closer is the log file opened by the file logger constructors
+	closer io.Closer
 }
 
+// RequestResponseMap describes an outbound call logged by ApiError. Bodies may
+// be []byte, strings or anything encoding/json can marshal.
 type RequestResponseMap struct {
 	Req     *http.Request
 	ReqBody interface{}
 	Res     *http.Response
 	ResBody interface{}
+	Latency time.Duration
 }
@@ -3,10 +3,13 @@ package methods
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	cryptorand "crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"math/rand"
 	"reflect"
 	"runtime/debug"
@@ -58,6 +61,25 @@ func GenerateRandomStringOfLength(length int) string {
 	return b.String()
 }
 
+// GenerateSecureDigits returns length random decimal digits from crypto/rand,
+// suitable for one-time codes.
+func GenerateSecureDigits(length int) (string, error) {
+	if length == 0 {
+		length = 6
+	}
+
+	var b strings.Builder
+	for i := 0; i < length; i++ {
+		n, err := cryptorand.Int(cryptorand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(n.String())
+	}
+
+	return b.String(), nil
+}
+
 func StringToIntArray(stringArray []string) []int {
 	var res []int
 
@@ -208,11 +230,20 @@ func Unique(arr []int) []int {
 }
 
 func PrettyPrint(msg string, data interface{}) {
-	if r, err := json.MarshalIndent(&data, "", "  "); err == nil {
-		fmt.Printf("[INFO] %v %v: \n %v\n", time.Now(), msg, string(r))
+	if r, err := PrettyJSON(data); err == nil {
+		fmt.Printf("[INFO] %v %v: \n %v\n", time.Now(), msg, r)
 	}
 }
 
+// PrettyJSON returns data as indented JSON, as printed by PrettyPrint
+func PrettyJSON(data interface{}) (string, error) {
+	r, err := json.MarshalIndent(&data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(r), nil
+}
+
 func BitsToMask(bits []int, bitSize int) uint64 {
 	mask := uint64(0)
 
@@ -307,6 +338,60 @@ func DecryptAES(key, encryptedText string) (string, error) {
 	return string(plainText), nil
 }
 
+// EncryptAESGCM encrypts plaintext with AES-GCM under key, which must be 16,
+// 24 or 32 bytes long. additionalData is authenticated but not encrypted, the
+// same must be given to decrypt. The random nonce is prepended to the base64
+// output.
+func EncryptAESGCM(key, plaintext, additionalData string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := cryptorand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	cipherText := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(additionalData))
+
+	return base64.StdEncoding.EncodeToString(cipherText), nil
+}
+
+// DecryptAESGCM decrypts the output of EncryptAESGCM, failing if it was
+// tampered with, encrypted under another key or with other additionalData.
+func DecryptAESGCM(key, encryptedText, additionalData string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	cipherText, err := base64.StdEncoding.DecodeString(encryptedText)
+	if err != nil {
+		return "", err
+	}
+	if len(cipherText) < gcm.NonceSize() {
+		return "", errors.New("aes-gcm: ciphertext too short")
+	}
+
+	nonce, cipherText := cipherText[:gcm.NonceSize()], cipherText[gcm.NonceSize():]
+	plainText, err := gcm.Open(nil, nonce, cipherText, []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plainText), nil
+}
+
+func newGCM(key string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
 func Chunks(s string, chunkSize int) []string {
 	if len(s) == 0 {
 		return nil
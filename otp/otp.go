@@ -0,0 +1,209 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+// Config configures the codes issued by a Service.
+type Config struct {
+	// Digits is the code length, 6 by default.
+	Digits int
+	// TTL is how long a code stays valid, 5 minutes by default.
+	TTL time.Duration
+	// MaxAttempts is the number of verifications allowed per code, 5 by default.
+	MaxAttempts int
+	// ResendCooldown is the minimum delay between two codes for the same
+	// subject, 1 minute by default.
+	ResendCooldown time.Duration
+	// Secret keys the hash of stored codes so a Redis dump does not reveal
+	// them. It is required.
+	Secret string
+}
+
+// Service issues and verifies one-time codes sent to users, e.g. by SMS or
+// email. Only an HMAC of each code is stored in Redis.
+type Service struct {
+	redis  *redisutil.Redis
+	config Config
+}
+
+type record struct {
+	Hash string `json:"hash"`
+}
+
+func NewService(r *redisutil.Redis, config Config) *Service {
+	if config.Digits == 0 {
+		config.Digits = 6
+	}
+	if config.TTL == 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 5
+	}
+	if config.ResendCooldown == 0 {
+		config.ResendCooldown = time.Minute
+	}
+
+	return &Service{
+		redis:  r,
+		config: config,
+	}
+}
+
+/*
+Issue generates a new code for subject, e.g. a phone number, and purpose,
+e.g. "login", replacing any previous one. It returns errutil.ErrOTPCooldown
+when called again for the same subject before ResendCooldown has passed.
+*/
+func (s *Service) Issue(purpose, subject string) (string, error) {
+	if utils.IsEmpty(s.config.Secret) {
+		return "", errutil.ErrOTPSecretMissing
+	}
+
+	key := otpKey(purpose, subject)
+	allowed, err := s.redis.SetNX(key+":cooldown", 1, s.config.ResendCooldown)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", errutil.ErrOTPCooldown
+	}
+
+	code, err := utils.GenerateSecureDigits(s.config.Digits)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.redis.Del(key + ":attempts"); err != nil {
+		return "", err
+	}
+	if err := s.redis.SetStruct(key, record{Hash: s.hash(key, code)}, s.config.TTL); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+/*
+Verify checks code for subject and purpose. A valid code is consumed, only
+one of concurrent verifications of it succeeding. Each call counts as an
+attempt; once MaxAttempts is reached the code is discarded and
+errutil.ErrOTPTooManyAttempts is returned.
+*/
+func (s *Service) Verify(purpose, subject, code string) error {
+	key := otpKey(purpose, subject)
+
+	if err := s.attempt(key); err != nil {
+		if err == errutil.ErrOTPTooManyAttempts {
+			_ = s.redis.Del(key)
+		}
+		return err
+	}
+
+	stored := record{}
+	if err := s.redis.GetStruct(key, &stored); err != nil {
+		if err == redis.Nil {
+			return errutil.ErrOTPExpired
+		}
+		return err
+	}
+
+	if !hmac.Equal([]byte(stored.Hash), []byte(s.hash(key, code))) {
+		return errutil.ErrOTPInvalid
+	}
+
+	// whoever deletes the code consumes it
+	deleted, err := s.redis.DelCount(key)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errutil.ErrOTPExpired
+	}
+
+	return s.redis.Del(key + ":attempts")
+}
+
+/*
+VerifyTOTP checks code against the TOTP secret of subject like ValidateTOTP,
+and rejects with errutil.ErrOTPReplayed a code already accepted or older than
+the last accepted one, as RFC 6238 section 5.2 requires. Accepted time steps
+are recorded in Redis for as long as the skew window lasts. Failed
+verifications count as attempts like in Verify: after MaxAttempts of them
+within TTL, errutil.ErrOTPTooManyAttempts is returned until TTL has passed.
+*/
+func (s *Service) VerifyTOTP(subject, secret, code string, skew int) error {
+	key := "otp:totp:" + subject
+	if err := s.attempt(key); err != nil {
+		return err
+	}
+
+	counter, ok := matchTOTP(secret, code, time.Now(), skew)
+	if !ok {
+		return errutil.ErrOTPInvalid
+	}
+
+	window := time.Duration(2*skew+2) * TOTPPeriod
+
+	last, err := s.redis.GetInt(key + ":last")
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if err == nil && counter <= int64(last) {
+		return errutil.ErrOTPReplayed
+	}
+
+	// SETNX settles concurrent verifications of the same code
+	fresh, err := s.redis.SetNX(key+":used:"+strconv.FormatInt(counter, 10), 1, window)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return errutil.ErrOTPReplayed
+	}
+
+	if err := s.redis.Set(key+":last", counter, window); err != nil {
+		return err
+	}
+
+	return s.redis.Del(key + ":attempts")
+}
+
+// attempt counts one verification against key, returning
+// errutil.ErrOTPTooManyAttempts past MaxAttempts. The count expires after TTL.
+func (s *Service) attempt(key string) error {
+	attempts, err := s.redis.IncByAndGet(key+":attempts", 1)
+	if err != nil {
+		return err
+	}
+	if attempts == 1 {
+		if _, err := s.redis.Expire(key+":attempts", s.config.TTL); err != nil {
+			return err
+		}
+	}
+	if attempts > int64(s.config.MaxAttempts) {
+		return errutil.ErrOTPTooManyAttempts
+	}
+
+	return nil
+}
+
+func (s *Service) hash(key, code string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Secret))
+	mac.Write([]byte(key + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func otpKey(purpose, subject string) string {
+	return "otp:" + purpose + ":" + subject
+}
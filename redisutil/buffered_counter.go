@@ -0,0 +1,160 @@
+package redisutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+// defaultFlushInterval is used when NewBufferedCounter gets no interval.
+const defaultFlushInterval = time.Second
+
+/*
+BufferedCounter aggregates increments in memory and writes them with a single
+INCRBY pipeline every interval, or as soon as maxKeys keys are pending. An
+increment whose flush fails stays pending and is retried with the next flush.
+Once closed, increments are written straight through.
+*/
+type BufferedCounter struct {
+	redis   *Redis
+	maxKeys int
+
+	mu      sync.Mutex
+	pending map[string]int64
+	closed  bool
+
+	flushMu sync.Mutex
+	full    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewBufferedCounter flushes every interval, every second when interval is not
+// positive, and whenever maxKeys keys are pending, 0 meaning no limit.
+func (r *Redis) NewBufferedCounter(interval time.Duration, maxKeys int) *BufferedCounter {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+
+	c := &BufferedCounter{
+		redis:   r,
+		maxKeys: maxKeys,
+		pending: map[string]int64{},
+		full:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run(interval)
+
+	return c
+}
+
+// IncBy adds value to the pending increment of key. After Close it is written
+// to Redis right away, the error being the one of INCRBY.
+func (c *BufferedCounter) IncBy(key string, value int64) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.redis.RedisClient.IncrBy(c.redis.getKey(key), value).Err()
+	}
+	c.pending[key] += value
+	full := c.maxKeys > 0 && len(c.pending) >= c.maxKeys
+	c.mu.Unlock()
+
+	if full {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Pending returns a snapshot of the increments not written to Redis yet.
+func (c *BufferedCounter) Pending() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := make(map[string]int64, len(c.pending))
+	for key, value := range c.pending {
+		pending[key] = value
+	}
+
+	return pending
+}
+
+// Flush writes every pending increment now.
+func (c *BufferedCounter) Flush() error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	batch := c.pending
+	c.pending = map[string]int64{}
+	c.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(batch))
+	pipe := c.redis.RedisClient.Pipeline()
+	for key, value := range batch {
+		keys = append(keys, key)
+		pipe.IncrBy(c.redis.getKey(key), value)
+	}
+	cmds, err := pipe.Exec()
+	if err == nil {
+		return nil
+	}
+
+	// put back the increments that did not make it, keeping the ones that did
+	c.mu.Lock()
+	for i, key := range keys {
+		if i >= len(cmds) || cmds[i].Err() != nil {
+			c.pending[key] += batch[key]
+		}
+	}
+	c.mu.Unlock()
+
+	return err
+}
+
+// Close stops the background flushes and writes what is still pending.
+// Closing again only retries that write.
+func (c *BufferedCounter) Close() error {
+	c.mu.Lock()
+	alreadyClosed := c.closed
+	c.closed = true
+	c.mu.Unlock()
+
+	if !alreadyClosed {
+		close(c.stop)
+		<-c.done
+	}
+
+	return c.Flush()
+}
+
+func (c *BufferedCounter) run(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.full:
+		}
+
+		if err := c.Flush(); err != nil && err != redis.Nil {
+			logger.Warn("failed to flush buffered counters: ", err)
+		}
+	}
+}
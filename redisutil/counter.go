@@ -0,0 +1,161 @@
+package redisutil
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+// Point is a single value of a time series, ready to be charted.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value int64     `json:"value"`
+}
+
+// Resolution is the bucket size of a time-bucketed counter together with how
+// long its buckets are retained.
+type Resolution struct {
+	Name      string
+	Step      time.Duration
+	Retention time.Duration
+}
+
+var (
+	Minute = Resolution{Name: "m", Step: time.Minute, Retention: 24 * time.Hour}
+	Hour   = Resolution{Name: "h", Step: time.Hour, Retention: 7 * 24 * time.Hour}
+	Day    = Resolution{Name: "d", Step: 24 * time.Hour, Retention: 365 * 24 * time.Hour}
+)
+
+// DefaultResolutions are the rollups maintained by IncBucket when none are given.
+var DefaultResolutions = []Resolution{Minute, Hour, Day}
+
+const (
+	// maxBuckets bounds the points BucketRange returns
+	maxBuckets = 100000
+	// mgetChunk bounds the keys BucketRange reads per MGET
+	mgetChunk = 1000
+)
+
+// IncByAndGet increments the counter stored at key by value and returns the new value.
+func (r *Redis) IncByAndGet(key string, value int64) (int64, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return 0, errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.IncrBy(key, value).Result()
+}
+
+/*
+IncBucket increments the time-bucketed counter of key at time at by value in
+every given resolution, DefaultResolutions when none are given. Each bucket
+expires once its resolution retention has passed.
+*/
+func (r *Redis) IncBucket(key string, at time.Time, value int64, resolutions ...Resolution) error {
+	if utils.IsEmpty(key) {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+	if len(resolutions) == 0 {
+		resolutions = DefaultResolutions
+	}
+
+	pipe := r.RedisClient.Pipeline()
+	for _, res := range resolutions {
+		bucket := at.UTC().Truncate(res.Step)
+		bucketKey := r.getKey(bucketKey(key, res, bucket))
+		pipe.IncrBy(bucketKey, value)
+		pipe.ExpireAt(bucketKey, bucket.Add(res.Step+res.Retention))
+	}
+	_, err := pipe.Exec()
+
+	return err
+}
+
+/*
+BucketRange returns one point per bucket of res between from and to
+inclusive. Buckets without data are returned with a zero value. Ranges of
+more than 100000 buckets return errutil.ErrBucketRangeTooLarge, and buckets
+are read 1000 at a time so that no single command blocks the server.
+*/
+func (r *Redis) BucketRange(key string, res Resolution, from, to time.Time) ([]Point, error) {
+	if res.Step <= 0 {
+		return nil, errutil.ErrInvalidResolution
+	}
+
+	from = from.UTC().Truncate(res.Step)
+	to = to.UTC().Truncate(res.Step)
+	if to.Sub(from)/res.Step >= maxBuckets {
+		return nil, errutil.ErrBucketRangeTooLarge
+	}
+
+	var buckets []time.Time
+	var keys []string
+	for bucket := from; !bucket.After(to); bucket = bucket.Add(res.Step) {
+		buckets = append(buckets, bucket)
+		keys = append(keys, r.getKey(bucketKey(key, res, bucket)))
+	}
+	if len(keys) == 0 {
+		return []Point{}, nil
+	}
+
+	values := make([]interface{}, 0, len(keys))
+	for start := 0; start < len(keys); start += mgetChunk {
+		end := start + mgetChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunk, err := r.RedisClient.MGet(keys[start:end]...).Result()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, chunk...)
+	}
+
+	points := make([]Point, 0, len(buckets))
+	for i, bucket := range buckets {
+		var value int64
+		if str, ok := values[i].(string); ok {
+			value, _ = strconv.ParseInt(str, 10, 64)
+		}
+		points = append(points, Point{Time: bucket, Value: value})
+	}
+
+	return points, nil
+}
+
+// BucketSum returns the total of the buckets of res between from and to.
+func (r *Redis) BucketSum(key string, res Resolution, from, to time.Time) (int64, error) {
+	points, err := r.BucketRange(key, res, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum int64
+	for _, p := range points {
+		sum += p.Value
+	}
+
+	return sum, nil
+}
+
+func bucketKey(key string, res Resolution, bucket time.Time) string {
+	return key + ":" + res.Name + ":" + strconv.FormatInt(bucket.Unix(), 10)
+}
+
+func (r *Redis) getKeys(keys []string) []string {
+	newKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		newKeys = append(newKeys, r.getKey(k))
+	}
+	return newKeys
+}
+
+func intCmdVal(cmd redis.Cmder) int64 {
+	if c, ok := cmd.(*redis.IntCmd); ok {
+		return c.Val()
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package redisutil
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+// encryptedPrefix marks encrypted values, it is followed by the key ID and the
+// AES-GCM ciphertext: enc:v1:<key id>:<base64>.
+const encryptedPrefix = "enc:v1:"
+
+// Keyring holds the AES keys used to encrypt cached values. New values are
+// encrypted with CurrentID, values written under an older key stay readable
+// as long as that key is kept in Keys.
+type Keyring struct {
+	CurrentID string
+	Keys      map[string]string
+}
+
+/*
+UseEncryption encrypts the values written by every helper storing values:
+Set, SetString, SetStruct, SetMany, SetNX, SetXX, SetKeepTTL, GetSet,
+HSetStruct and the Set and SetString of transactions, and decrypts them in
+every helper returning values. Counters (IncBy, buckets, BufferedCounter) and
+Publish are not encrypted as Redis has to read them. Keys must be 16, 24 or 32
+bytes long. Plain values already in the cache are still returned as is, so
+encryption can be turned on without flushing.
+
+Ciphertexts are bound to the key they are stored under, without Prefix: a
+value copied to another key fails to decrypt, while one moved to another
+prefix, as MigratePrefix does, still decrypts with the same keyring.
+*/
+func (r *Redis) UseEncryption(keyring *Keyring) error {
+	if keyring == nil {
+		r.encryption = nil
+		return nil
+	}
+	if _, ok := keyring.Keys[keyring.CurrentID]; !ok || strings.Contains(keyring.CurrentID, ":") {
+		return errutil.ErrInvalidEncryptionKey
+	}
+	if _, err := utils.EncryptAESGCM(keyring.Keys[keyring.CurrentID], "", ""); err != nil {
+		return errutil.ErrInvalidEncryptionKey
+	}
+
+	r.encryption = keyring
+	return nil
+}
+
+// encrypt encrypts value stored at key, the prefixed key. The key without
+// prefix is bound to the ciphertext as additional data.
+func (r *Redis) encrypt(key, value string) (string, error) {
+	if r.encryption == nil {
+		return value, nil
+	}
+
+	id := r.encryption.CurrentID
+	cipherText, err := utils.EncryptAESGCM(r.encryption.Keys[id], value, r.StripPrefix(key))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + id + ":" + cipherText, nil
+}
+
+// decrypt decrypts value read from key, the prefixed key.
+func (r *Redis) decrypt(key, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if r.encryption == nil {
+		return "", errutil.ErrDecryptFailed
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errutil.ErrDecryptFailed
+	}
+	secret, ok := r.encryption.Keys[parts[0]]
+	if !ok {
+		return "", errutil.ErrDecryptFailed
+	}
+
+	plainText, err := utils.DecryptAESGCM(secret, parts[1], r.StripPrefix(key))
+	if err != nil {
+		return "", errutil.ErrDecryptFailed
+	}
+
+	return plainText, nil
+}
+
+// hashFieldKey is the key hash fields are bound to when encrypted, the prefix
+// of key being stripped by encrypt and decrypt like for plain keys.
+func hashFieldKey(key, field string) string {
+	return key + "\x00" + field
+}
+
+// encode marshals value to JSON and encrypts it for key, the prefixed key.
+func (r *Redis) encode(key string, value interface{}) (string, error) {
+	serializedValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return r.encrypt(key, string(serializedValue))
+}
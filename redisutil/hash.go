@@ -0,0 +1,98 @@
+package redisutil
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+// HSetStruct stores value as JSON in field of the hash stored at key.
+func (r *Redis) HSetStruct(key, field string, value interface{}) error {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || utils.IsEmpty(field) {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	storedValue, err := r.encode(hashFieldKey(key, field), value)
+	if err != nil {
+		return err
+	}
+
+	return r.RedisClient.HSet(key, field, storedValue).Err()
+}
+
+// HGetStruct reads field of the hash stored at key into outputStruct.
+func (r *Redis) HGetStruct(key, field string, outputStruct interface{}) error {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || utils.IsEmpty(field) {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	serializedValue, err := r.RedisClient.HGet(key, field).Result()
+	if err != nil {
+		return err
+	}
+	if serializedValue, err = r.decrypt(hashFieldKey(key, field), serializedValue); err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(serializedValue), outputStruct)
+}
+
+// HGetAll returns every field of the hash stored at key, decrypted.
+func (r *Redis) HGetAll(key string) (map[string]string, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return nil, errutil.ErrEmptyRedisKeyValue
+	}
+
+	all, err := r.RedisClient.HGetAll(key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for field, value := range all {
+		if all[field], err = r.decrypt(hashFieldKey(key, field), value); err != nil {
+			return nil, err
+		}
+	}
+
+	return all, nil
+}
+
+// HDel removes fields from the hash stored at key.
+func (r *Redis) HDel(key string, fields ...string) error {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || len(fields) == 0 {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.HDel(key, fields...).Err()
+}
+
+// Publish sends message to channel. The channel is prefixed like keys so that
+// services sharing a Redis do not see each other's messages.
+func (r *Redis) Publish(channel string, message interface{}) error {
+	channel = r.getKey(channel)
+	if utils.IsEmpty(channel) {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.Publish(channel, message).Err()
+}
+
+// Subscribe subscribes to the prefixed channels. Messages carry the prefixed
+// channel name, use StripPrefix to get it back.
+func (r *Redis) Subscribe(channels ...string) *redis.PubSub {
+	return r.RedisClient.Subscribe(r.getKeys(channels)...)
+}
+
+// StripPrefix removes the Redis prefix from a key or channel name.
+func (r *Redis) StripPrefix(key string) string {
+	if len(key) >= len(r.Prefix) && key[:len(r.Prefix)] == r.Prefix {
+		return key[len(r.Prefix):]
+	}
+	return key
+}
@@ -0,0 +1,138 @@
+package redisutil
+
+import (
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+const dayLayout = "2006-01-02"
+
+// PFAdd adds elements to the HyperLogLog stored at key. It returns true if
+// the estimated cardinality changed.
+func (r *Redis) PFAdd(key string, els ...interface{}) (bool, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || len(els) == 0 {
+		return false, errutil.ErrEmptyRedisKeyValue
+	}
+
+	changed, err := r.RedisClient.PFAdd(key, els...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return changed == 1, nil
+}
+
+// PFCount returns the approximate number of unique elements across the
+// HyperLogLogs stored at keys.
+func (r *Redis) PFCount(keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.PFCount(r.getKeys(keys)...).Result()
+}
+
+// PFMerge merges the HyperLogLogs stored at keys into dest.
+func (r *Redis) PFMerge(dest string, keys ...string) error {
+	if utils.IsEmpty(dest) || len(keys) == 0 {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.PFMerge(r.getKey(dest), r.getKeys(keys)...).Err()
+}
+
+/*
+AddUnique records members in the daily HyperLogLog of key for the day of at.
+Daily keys expire after ttl, a zero ttl keeps them forever.
+*/
+func (r *Redis) AddUnique(key string, at time.Time, ttl time.Duration, members ...interface{}) error {
+	if utils.IsEmpty(key) || len(members) == 0 {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	dayKey := r.getKey(uniqueDayKey(key, at))
+	pipe := r.RedisClient.Pipeline()
+	pipe.PFAdd(dayKey, members...)
+	if ttl > 0 {
+		pipe.Expire(dayKey, ttl)
+	}
+	_, err := pipe.Exec()
+
+	return err
+}
+
+// CountUnique returns the number of unique members of key between from and to
+// inclusive, counting a member seen on several days only once.
+func (r *Redis) CountUnique(key string, from, to time.Time) (int64, error) {
+	days := uniqueDays(from, to)
+	if len(days) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, 0, len(days))
+	for _, day := range days {
+		keys = append(keys, uniqueDayKey(key, day))
+	}
+
+	return r.PFCount(keys...)
+}
+
+// MergeUnique merges the daily HyperLogLogs of key between from and to into
+// dest so that the range can be counted again later without re-merging.
+func (r *Redis) MergeUnique(dest, key string, from, to time.Time) error {
+	days := uniqueDays(from, to)
+	if len(days) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(days))
+	for _, day := range days {
+		keys = append(keys, uniqueDayKey(key, day))
+	}
+
+	return r.PFMerge(dest, keys...)
+}
+
+// UniqueSeries returns one point per day between from and to holding the
+// unique count of that day.
+func (r *Redis) UniqueSeries(key string, from, to time.Time) ([]Point, error) {
+	days := uniqueDays(from, to)
+	if len(days) == 0 {
+		return []Point{}, nil
+	}
+
+	pipe := r.RedisClient.Pipeline()
+	for _, day := range days {
+		pipe.PFCount(r.getKey(uniqueDayKey(key, day)))
+	}
+	cmds, err := pipe.Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]Point, 0, len(days))
+	for i, day := range days {
+		points = append(points, Point{Time: day, Value: intCmdVal(cmds[i])})
+	}
+
+	return points, nil
+}
+
+func uniqueDayKey(key string, day time.Time) string {
+	return key + ":" + day.UTC().Format(dayLayout)
+}
+
+func uniqueDays(from, to time.Time) []time.Time {
+	from = from.UTC().Truncate(24 * time.Hour)
+	to = to.UTC().Truncate(24 * time.Hour)
+
+	var days []time.Time
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+
+	return days
+}
@@ -0,0 +1,166 @@
+package redisutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+// minLeaderLease is the shortest lease NewLeaderElection accepts.
+const minLeaderLease = 100 * time.Millisecond
+
+var (
+	leaderRenew = RegisterScript("redisutil:leader:renew", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+	leaderRelease = RegisterScript("redisutil:leader:release", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// LeaderElection elects one leader among the replicas running it for the same
+// name. Leadership is a lease renewed every third of its duration.
+type LeaderElection struct {
+	// OnElected runs in its own goroutine when leadership is gained. ctx is
+	// cancelled as soon as the lease is lost.
+	OnElected func(ctx context.Context)
+	// OnLost is called after ctx of OnElected has been cancelled.
+	OnLost func()
+
+	redis *Redis
+	name  string
+	id    string
+	lease time.Duration
+}
+
+// NewLeaderElection returns an election for name. lease must be at least 100ms.
+func (r *Redis) NewLeaderElection(name string, lease time.Duration) (*LeaderElection, error) {
+	if utils.IsEmpty(name) || lease < minLeaderLease {
+		return nil, errutil.ErrInvalidLeaderLease
+	}
+
+	id, err := newHolderID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderElection{
+		redis: r,
+		name:  name,
+		id:    id,
+		lease: lease,
+	}, nil
+}
+
+/*
+Run campaigns for leadership until ctx is done, then steps down by deleting
+the lease so another replica can take over without waiting for it to expire.
+*/
+func (l *LeaderElection) Run(ctx context.Context) {
+	key := l.redis.getKey(l.key())
+	interval := l.lease / 3
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// the lease starts on the server before the reply comes back
+		sent := time.Now()
+		won, err := l.redis.RedisClient.SetNX(key, l.id, l.lease).Result()
+		if err != nil {
+			logger.Warn("leader election ", l.name, " failed to campaign: ", err)
+		}
+		if won {
+			l.lead(ctx, ticker, sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead holds leadership, acquired by a request sent at sent, until the lease is
+// lost or ctx is done.
+func (l *LeaderElection) lead(ctx context.Context, ticker *time.Ticker, sent time.Time) {
+	logger.Info("leader election ", l.name, ": became leader")
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	if l.OnElected != nil {
+		go l.OnElected(leaderCtx)
+	}
+
+	// the lease is lost once it expires without a successful renewal
+	expiry := time.NewTimer(l.remaining(sent))
+	defer expiry.Stop()
+
+	defer func() {
+		cancel()
+		if l.OnLost != nil {
+			l.OnLost()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if _, err := leaderRelease.Run(l.redis, []string{l.key()}, l.id); err != nil {
+				logger.Warn("leader election ", l.name, " failed to release lease: ", err)
+			}
+			logger.Info("leader election ", l.name, ": stepped down")
+			return
+		case <-expiry.C:
+			logger.Warn("leader election ", l.name, ": lease expired before renewal")
+			return
+		case <-ticker.C:
+			sent := time.Now()
+			res, err := leaderRenew.Run(l.redis, []string{l.key()}, l.id, l.lease.Milliseconds())
+			if err != nil {
+				logger.Warn("leader election ", l.name, " failed to renew lease: ", err)
+				continue
+			}
+			if renewed, _ := res.(int64); renewed != 1 {
+				logger.Warn("leader election ", l.name, ": lease taken over")
+				return
+			}
+			if !expiry.Stop() {
+				<-expiry.C
+			}
+			expiry.Reset(l.remaining(sent))
+		}
+	}
+}
+
+/*
+remaining returns how long a lease requested at sent can be relied on. The
+server started the lease somewhere between sent and the reply, so counting from
+sent never outlives it, and a tenth of the lease is kept as a margin for clock
+drift.
+*/
+func (l *LeaderElection) remaining(sent time.Time) time.Duration {
+	remaining := time.Until(sent.Add(l.lease - l.lease/10))
+	if remaining <= 0 {
+		return time.Nanosecond
+	}
+	return remaining
+}
+
+// ID returns the identity this replica campaigns with.
+func (l *LeaderElection) ID() string {
+	return l.id
+}
+
+func (l *LeaderElection) key() string {
+	return "leader:" + l.name
+}
@@ -0,0 +1,171 @@
+package redisutil
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+const defaultMigrateBatch = 100
+
+// MigrateOptions configures MigratePrefix.
+type MigrateOptions struct {
+	// Target receives the keys, nil copies within the source instance.
+	Target *Redis
+	// ToPrefix replaces the source prefix, it defaults to Target.Prefix.
+	ToPrefix string
+	// Move deletes every source key once it has been copied.
+	Move bool
+	// Replace overwrites existing target keys instead of skipping them.
+	Replace bool
+	// BatchSize is the SCAN count hint, 100 by default.
+	BatchSize int64
+	// KeysPerSecond throttles the copy, zero means no limit.
+	KeysPerSecond int
+	// Cursor resumes an interrupted run from the cursor it reported.
+	Cursor uint64
+}
+
+// MigrateProgress reports how far a migration got. Cursor is zero once the
+// whole keyspace has been scanned.
+type MigrateProgress struct {
+	Cursor  uint64
+	Scanned int64
+	Copied  int64
+	Skipped int64
+}
+
+/*
+MigratePrefix copies every key under r.Prefix to opts.ToPrefix with DUMP and
+RESTORE, keeping TTLs. Progress is logged after each SCAN batch; on error or
+cancellation the returned progress holds the cursor to resume from.
+*/
+func (r *Redis) MigratePrefix(ctx context.Context, opts MigrateOptions) (MigrateProgress, error) {
+	target := opts.Target
+	if target == nil {
+		target = r
+	}
+	toPrefix := opts.ToPrefix
+	if toPrefix == "" && opts.Target != nil {
+		toPrefix = opts.Target.Prefix
+	}
+	// on the same instance the copies must neither match the source SCAN
+	// pattern nor overwrite source keys not migrated yet
+	if sameInstance(r, target) && (strings.HasPrefix(toPrefix, r.Prefix) || strings.HasPrefix(r.Prefix, toPrefix)) {
+		return MigrateProgress{}, errutil.ErrInvalidMigration
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultMigrateBatch
+	}
+
+	var delay time.Duration
+	if opts.KeysPerSecond > 0 {
+		delay = time.Second / time.Duration(opts.KeysPerSecond)
+	}
+
+	progress := MigrateProgress{Cursor: opts.Cursor}
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		keys, next, err := r.RedisClient.Scan(progress.Cursor, r.Prefix+"*", opts.BatchSize).Result()
+		if err != nil {
+			return progress, err
+		}
+
+		started := time.Now()
+		for _, key := range keys {
+			copied, err := r.migrateKey(target, key, toPrefix+strings.TrimPrefix(key, r.Prefix), opts)
+			if err != nil {
+				return progress, err
+			}
+			progress.Scanned++
+			if copied {
+				progress.Copied++
+			} else {
+				progress.Skipped++
+			}
+		}
+
+		// resume from the next batch, keys of this one are done
+		progress.Cursor = next
+		logger.InfoWithFields("redis prefix migration progress", map[string]interface{}{
+			"from":    r.Prefix,
+			"to":      toPrefix,
+			"cursor":  progress.Cursor,
+			"scanned": progress.Scanned,
+			"copied":  progress.Copied,
+			"skipped": progress.Skipped,
+		})
+
+		if next == 0 {
+			return progress, nil
+		}
+
+		if wait := delay*time.Duration(len(keys)) - time.Since(started); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return progress, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+// migrateKey copies key to newKey on target. It returns false when the key
+// expired in the meantime or already exists on target without Replace.
+func (r *Redis) migrateKey(target *Redis, key, newKey string, opts MigrateOptions) (bool, error) {
+	pipe := r.RedisClient.Pipeline()
+	dumpCmd := pipe.Dump(key)
+	ttlCmd := pipe.PTTL(key)
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		return false, err
+	}
+
+	dump, err := dumpCmd.Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ttl := ttlCmd.Val()
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	if opts.Replace {
+		err = target.RedisClient.RestoreReplace(newKey, ttl, dump).Err()
+	} else {
+		err = target.RedisClient.Restore(newKey, ttl, dump).Err()
+	}
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if opts.Move {
+		if err := r.RedisClient.Del(key).Err(); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// sameInstance reports whether a and b use the same Redis database.
+func sameInstance(a, b *Redis) bool {
+	if a == b {
+		return true
+	}
+	optsA, optsB := a.RedisClient.Options(), b.RedisClient.Options()
+	return optsA.Addr == optsB.Addr && optsA.DB == optsB.DB
+}
@@ -0,0 +1,157 @@
+package redisutil
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+// KeyEventType is the name of a Redis keyevent notification.
+type KeyEventType string
+
+const (
+	KeyExpired KeyEventType = "expired"
+	KeyEvicted KeyEventType = "evicted"
+	KeySet     KeyEventType = "set"
+	KeyDel     KeyEventType = "del"
+)
+
+// notifyKeyspaceEvents enables keyevent notifications for generic (del),
+// string (set), expired and evicted events.
+const notifyKeyspaceEvents = "Eg$xe"
+
+// KeyEvent is a keyevent notification for a key of the Redis prefix. Key has
+// the prefix stripped.
+type KeyEvent struct {
+	Type KeyEventType
+	Key  string
+}
+
+type KeyEventHandler func(event KeyEvent)
+
+// KeyEventListener dispatches keyevent notifications for the keys under the
+// Redis prefix that match a Redis glob pattern, see MatchGlob.
+type KeyEventListener struct {
+	redis    *Redis
+	pattern  string
+	mu       sync.RWMutex
+	handlers map[KeyEventType][]KeyEventHandler
+}
+
+// NewKeyEventListener returns a listener for the keys matching pattern, the
+// pattern is matched against the key without prefix.
+func (r *Redis) NewKeyEventListener(pattern string) *KeyEventListener {
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	return &KeyEventListener{
+		redis:    r,
+		pattern:  pattern,
+		handlers: map[KeyEventType][]KeyEventHandler{},
+	}
+}
+
+// On registers handler for events of type t. Handlers are called one at a
+// time in the listener goroutine.
+func (l *KeyEventListener) On(t KeyEventType, handler KeyEventHandler) *KeyEventListener {
+	l.mu.Lock()
+	l.handlers[t] = append(l.handlers[t], handler)
+	l.mu.Unlock()
+
+	return l
+}
+
+/*
+Run enables keyevent notifications on the server, on top of those already
+configured for other consumers, subscribes to the events that have handlers and
+dispatches them until ctx is done. Servers that forbid CONFIG SET must have
+notify-keyspace-events configured beforehand.
+*/
+func (l *KeyEventListener) Run(ctx context.Context) error {
+	client := l.redis.RedisClient
+	if err := enableKeyspaceEvents(l.redis); err != nil {
+		logger.Warn("failed to enable redis keyspace notifications: ", err)
+	}
+
+	db := strconv.Itoa(client.Options().DB)
+	channelPrefix := "__keyevent@" + db + "__:"
+
+	l.mu.RLock()
+	var channels []string
+	for t := range l.handlers {
+		channels = append(channels, channelPrefix+string(t))
+	}
+	l.mu.RUnlock()
+	if len(channels) == 0 {
+		return nil
+	}
+
+	pubsub := client.Subscribe(channels...)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(); err != nil {
+		return err
+	}
+	messages := pubsub.Channel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			l.dispatch(KeyEventType(strings.TrimPrefix(msg.Channel, channelPrefix)), msg.Payload)
+		}
+	}
+}
+
+func (l *KeyEventListener) dispatch(t KeyEventType, key string) {
+	if !strings.HasPrefix(key, l.redis.Prefix) {
+		return
+	}
+	key = strings.TrimPrefix(key, l.redis.Prefix)
+	if !MatchGlob(l.pattern, key) {
+		return
+	}
+
+	l.mu.RLock()
+	handlers := l.handlers[t]
+	l.mu.RUnlock()
+
+	event := KeyEvent{Type: t, Key: key}
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// enableKeyspaceEvents adds the notifyKeyspaceEvents flags to the configured
+// ones, leaving the configuration alone when they are all there.
+func enableKeyspaceEvents(r *Redis) error {
+	reply, err := r.RedisClient.ConfigGet("notify-keyspace-events").Result()
+	if err != nil {
+		return err
+	}
+
+	current := ""
+	if len(reply) == 2 {
+		current, _ = reply[1].(string)
+	}
+
+	merged := current
+	for _, flag := range notifyKeyspaceEvents {
+		if !strings.ContainsRune(merged, flag) {
+			merged += string(flag)
+		}
+	}
+	if merged == current {
+		return nil
+	}
+
+	return r.RedisClient.ConfigSet("notify-keyspace-events", merged).Err()
+}
@@ -3,6 +3,7 @@ package redisutil
 import (
 	"encoding/json"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -14,6 +15,14 @@ import (
 type Redis struct {
 	Prefix      string
 	RedisClient *redis.Client
+	// TTLJitter randomly extends every TTL written through Redis by up to
+	// this fraction of the TTL, e.g. 0.1 for up to 10%, to avoid keys written
+	// together expiring together.
+	TTLJitter float64
+
+	replicas     atomic.Pointer[replicaSet]
+	forcePrimary bool
+	encryption   *Keyring
 }
 
 /*
@@ -21,6 +30,16 @@ Connect method takes the redis credentials and prefix as input. It's then
 connect to redis instance and return Redis util object otherwise create panic
 */
 func Connect(host, port, pass string, db int, prefix string) *Redis {
+	r, err := Dial(host, port, pass, db, prefix)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
+
+// Dial is like Connect but returns the connection error instead of panicking.
+func Dial(host, port, pass string, db int, prefix string) (*Redis, error) {
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     host + ":" + port,
 		Password: pass,
@@ -29,17 +48,21 @@ func Connect(host, port, pass string, db int, prefix string) *Redis {
 	logger.Info("connecting to redis at ", host, ":", port, "...")
 	if _, err := redisClient.Ping().Result(); err != nil {
 		logger.Error("failed to connect redis: ", err)
-		panic(err)
+		_ = redisClient.Close()
+		return nil, err
 	}
 	logger.Info("redis connection successful...")
-	return &Redis{
+	r := &Redis{
 		RedisClient: redisClient,
 		Prefix:      prefix,
 	}
+	// scripts are run with an EVAL fallback, a failed preload is not fatal
+	_ = r.LoadScripts()
 
+	return r, nil
 }
 
-func (r *Redis) Set(key string, value interface{}, ttl int) error {
+func (r *Redis) Set(key string, value interface{}, ttl time.Duration) error {
 	key = r.getKey(key)
 	if utils.IsEmpty(key) || utils.IsEmpty(value) {
 		return errutil.ErrEmptyRedisKeyValue
@@ -50,16 +73,26 @@ func (r *Redis) Set(key string, value interface{}, ttl int) error {
 		return err
 	}
 
-	return r.RedisClient.Set(key, string(serializedValue), time.Duration(ttl)*time.Second).Err()
+	storedValue, err := r.encrypt(key, string(serializedValue))
+	if err != nil {
+		return err
+	}
+
+	return r.RedisClient.Set(key, storedValue, r.expiration(ttl)).Err()
 }
 
-func (r *Redis) SetString(key string, value string, ttl int) error {
+func (r *Redis) SetString(key string, value string, ttl time.Duration) error {
 	key = r.getKey(key)
 	if utils.IsEmpty(key) || utils.IsEmpty(value) {
 		return errutil.ErrEmptyRedisKeyValue
 	}
 
-	return r.RedisClient.Set(key, value, time.Duration(ttl)*time.Second).Err()
+	storedValue, err := r.encrypt(key, value)
+	if err != nil {
+		return err
+	}
+
+	return r.RedisClient.Set(key, storedValue, r.expiration(ttl)).Err()
 }
 
 func (r *Redis) SetStruct(key string, value interface{}, ttl time.Duration) error {
@@ -69,7 +102,49 @@ func (r *Redis) SetStruct(key string, value interface{}, ttl time.Duration) erro
 		return err
 	}
 
-	return r.RedisClient.Set(key, string(serializedValue), ttl*time.Second).Err()
+	storedValue, err := r.encrypt(key, string(serializedValue))
+	if err != nil {
+		return err
+	}
+
+	return r.RedisClient.Set(key, storedValue, r.expiration(ttl)).Err()
+}
+
+// Entry is a key/value pair written by SetMany.
+type Entry struct {
+	Key   string
+	Value interface{}
+	TTL   time.Duration
+}
+
+// SetMany stores entries like Set in a single pipeline.
+func (r *Redis) SetMany(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pipe := r.RedisClient.Pipeline()
+	for _, entry := range entries {
+		key := r.getKey(entry.Key)
+		if utils.IsEmpty(key) || utils.IsEmpty(entry.Value) {
+			return errutil.ErrEmptyRedisKeyValue
+		}
+
+		serializedValue, err := json.Marshal(entry.Value)
+		if err != nil {
+			return err
+		}
+
+		storedValue, err := r.encrypt(key, string(serializedValue))
+		if err != nil {
+			return err
+		}
+
+		pipe.Set(key, storedValue, r.expiration(entry.TTL))
+	}
+	_, err := pipe.Exec()
+
+	return err
 }
 
 func (r *Redis) Get(key string) (string, error) {
@@ -78,7 +153,12 @@ func (r *Redis) Get(key string) (string, error) {
 		return "", errutil.ErrEmptyRedisKeyValue
 	}
 
-	return r.RedisClient.Get(key).Result()
+	str, err := r.reader().Get(key).Result()
+	if err != nil {
+		return "", err
+	}
+
+	return r.decrypt(key, str)
 }
 
 func (r *Redis) GetInt(key string) (int, error) {
@@ -87,11 +167,15 @@ func (r *Redis) GetInt(key string) (int, error) {
 		return 0, errutil.ErrEmptyRedisKeyValue
 	}
 
-	str, err := r.RedisClient.Get(key).Result()
+	str, err := r.reader().Get(key).Result()
 	if err != nil {
 		return 0, err
 	}
 
+	if str, err = r.decrypt(key, str); err != nil {
+		return 0, err
+	}
+
 	return strconv.Atoi(str)
 }
 func (r *Redis) GetStruct(key string, outputStruct interface{}) error {
@@ -100,11 +184,15 @@ func (r *Redis) GetStruct(key string, outputStruct interface{}) error {
 		return errutil.ErrEmptyRedisKeyValue
 	}
 
-	serializedValue, err := r.RedisClient.Get(key).Result()
+	serializedValue, err := r.reader().Get(key).Result()
 	if err != nil {
 		return err
 	}
 
+	if serializedValue, err = r.decrypt(key, serializedValue); err != nil {
+		return err
+	}
+
 	if err := json.Unmarshal([]byte(serializedValue), &outputStruct); err != nil {
 		return err
 	}
@@ -114,7 +202,7 @@ func (r *Redis) GetStruct(key string, outputStruct interface{}) error {
 
 func (r *Redis) HasKey(key string) bool {
 	key = r.getKey(key)
-	exists, err := r.RedisClient.Exists(key).Result()
+	exists, err := r.reader().Exists(key).Result()
 	if err != nil {
 		return false
 	}
@@ -143,6 +231,12 @@ func (r *Redis) Del(keys ...string) error {
 	return r.RedisClient.Del(newKey...).Err()
 }
 
+// DelCount deletes keys and returns how many of them existed, which tells
+// concurrent callers deleting the same key which one removed it.
+func (r *Redis) DelCount(keys ...string) (int64, error) {
+	return r.RedisClient.Del(r.getKeys(keys)...).Result()
+}
+
 func (r *Redis) DelPattern(pattern string) error {
 	pattern = r.getKey(pattern)
 	iter := r.RedisClient.Scan(0, pattern, 0).Iterator()
@@ -161,6 +255,33 @@ func (r *Redis) DelPattern(pattern string) error {
 	return nil
 }
 
+// Keys returns the keys matching pattern with SCAN, without prefix.
+func (r *Redis) Keys(pattern string) ([]string, error) {
+	pattern = r.getKey(pattern)
+	iter := r.RedisClient.Scan(0, pattern, 0).Iterator()
+
+	keys := []string{}
+	for iter.Next() {
+		keys = append(keys, r.StripPrefix(iter.Val()))
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// MemoryUsage returns the number of bytes key and its value take in Redis.
+func (r *Redis) MemoryUsage(key string) (int64, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return 0, errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.MemoryUsage(key).Result()
+}
+
 func (r *Redis) getKey(key string) string {
 	return r.Prefix + key
 }
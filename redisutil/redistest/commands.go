@@ -0,0 +1,731 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+type command struct {
+	// arity counts the command name, negative values are a minimum
+	arity int
+	fn    func(c *conn, args []string) interface{}
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":     {-1, cmdPing},
+		"echo":     {2, func(c *conn, args []string) interface{} { return args[1] }},
+		"auth":     {-2, func(c *conn, args []string) interface{} { return ok }},
+		"select":   {2, cmdSelect},
+		"config":   {-2, cmdConfig},
+		"quit":     {1, func(c *conn, args []string) interface{} { return ok }},
+		"dbsize":   {1, cmdDBSize},
+		"flushdb":  {-1, cmdFlushDB},
+		"flushall": {-1, cmdFlushAll},
+		"script":   {-2, cmdScript},
+		"eval":     {-3, cmdEval},
+		"evalsha":  {-3, cmdEval},
+
+		"get":    {2, cmdGet},
+		"set":    {-3, cmdSet},
+		"setnx":  {3, cmdSetNX},
+		"getset": {3, cmdGetSet},
+		"getex":  {-2, cmdGetEx},
+		"mget":   {-2, cmdMGet},
+		"incr":   {2, func(c *conn, args []string) interface{} { return incrBy(c, args[1], 1) }},
+		"decr":   {2, func(c *conn, args []string) interface{} { return incrBy(c, args[1], -1) }},
+		"incrby": {3, cmdIncrBy},
+		"decrby": {3, cmdIncrBy},
+
+		"exists":    {-2, cmdExists},
+		"del":       {-2, cmdDel},
+		"type":      {2, cmdType},
+		"keys":      {2, cmdKeys},
+		"scan":      {-2, cmdScan},
+		"ttl":       {2, cmdTTL},
+		"pttl":      {2, cmdTTL},
+		"expire":    {3, cmdExpire},
+		"pexpire":   {3, cmdExpire},
+		"expireat":  {3, cmdExpire},
+		"pexpireat": {3, cmdExpire},
+		"persist":   {2, cmdPersist},
+
+		"hset":    {-4, cmdHSet},
+		"hget":    {3, cmdHGet},
+		"hgetall": {2, cmdHGetAll},
+		"hdel":    {-3, cmdHDel},
+		"hexists": {3, cmdHExists},
+		"hlen":    {2, cmdHLen},
+	}
+}
+
+// dispatch runs args on behalf of c and returns the reply to write.
+func (s *Server) dispatch(c *conn, args []string) interface{} {
+	name := strings.ToLower(args[0])
+
+	if c.subscriptions() > 0 {
+		switch name {
+		case "subscribe", "psubscribe", "unsubscribe", "punsubscribe", "quit":
+		case "ping":
+			payload := ""
+			if len(args) > 1 {
+				payload = args[1]
+			}
+			return []interface{}{"pong", payload}
+		default:
+			return errReply("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+		}
+	}
+
+	switch name {
+	case "subscribe", "psubscribe":
+		if len(args) < 2 {
+			return errArity(name)
+		}
+		return s.subscribe(c, name == "psubscribe", args[1:])
+	case "unsubscribe", "punsubscribe":
+		return s.unsubscribe(c, name == "punsubscribe", args[1:])
+	case "publish":
+		if len(args) != 3 {
+			return errArity(name)
+		}
+		return s.publish(args[1], args[2])
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch name {
+	case "multi":
+		if c.multi {
+			return errReply("ERR MULTI calls can not be nested")
+		}
+		c.multi = true
+		c.queued = nil
+		return ok
+	case "exec":
+		if !c.multi {
+			return errReply("ERR EXEC without MULTI")
+		}
+		return s.exec(c)
+	case "discard":
+		if !c.multi {
+			return errReply("ERR DISCARD without MULTI")
+		}
+		c.multi = false
+		c.queued = nil
+		c.watched = nil
+		return ok
+	case "watch":
+		if c.multi {
+			return errReply("ERR WATCH inside MULTI is not allowed")
+		}
+		if len(args) < 2 {
+			return errArity(name)
+		}
+		if c.watched == nil {
+			c.watched = map[string]uint64{}
+		}
+		d := s.db(c.db)
+		for _, key := range args[1:] {
+			d.get(key, s.now())
+			c.watched[watchKey(c.db, key)] = d.versions[key]
+		}
+		return ok
+	case "unwatch":
+		c.watched = nil
+		return ok
+	}
+
+	cmd, found := commands[name]
+	if !found {
+		return errReply("ERR unknown command '" + args[0] + "'")
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		return errArity(name)
+	}
+
+	if c.multi {
+		c.queued = append(c.queued, args)
+		return status("QUEUED")
+	}
+
+	return cmd.fn(c, args)
+}
+
+func (s *Server) exec(c *conn) interface{} {
+	queued := c.queued
+	watched := c.watched
+	c.multi = false
+	c.queued = nil
+	c.watched = nil
+
+	for key, version := range watched {
+		parts := strings.SplitN(key, ":", 2)
+		index, _ := strconv.Atoi(parts[0])
+		d := s.db(index)
+		d.get(parts[1], s.now())
+		if d.versions[parts[1]] != version {
+			return nilArray{}
+		}
+	}
+
+	results := make([]interface{}, 0, len(queued))
+	for _, args := range queued {
+		results = append(results, commands[strings.ToLower(args[0])].fn(c, args))
+	}
+
+	return results
+}
+
+func watchKey(db int, key string) string {
+	return strconv.Itoa(db) + ":" + key
+}
+
+func cmdPing(c *conn, args []string) interface{} {
+	if len(args) > 1 {
+		return args[1]
+	}
+	return status("PONG")
+}
+
+func cmdSelect(c *conn, args []string) interface{} {
+	index, err := strconv.Atoi(args[1])
+	if err != nil || index < 0 {
+		return errReply("ERR DB index is out of range")
+	}
+	c.db = index
+	return ok
+}
+
+// cmdConfig keeps the parameters set, without acting on any of them.
+func cmdConfig(c *conn, args []string) interface{} {
+	switch strings.ToLower(args[1]) {
+	case "get":
+		if len(args) != 3 {
+			return errArity("config|get")
+		}
+		names := make([]string, 0, len(c.server.config))
+		for name := range c.server.config {
+			if redisutil.MatchGlob(strings.ToLower(args[2]), name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, 2*len(names))
+		for _, name := range names {
+			pairs = append(pairs, name, c.server.config[name])
+		}
+		return pairs
+	case "set":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return errArity("config|set")
+		}
+		for i := 2; i < len(args); i += 2 {
+			c.server.config[strings.ToLower(args[i])] = args[i+1]
+		}
+		return ok
+	case "resetstat":
+		return ok
+	}
+	return errSyntax
+}
+
+// cmdScript caches scripts by SHA1 so that EVALSHA can tell loaded scripts
+// from unknown ones.
+func cmdScript(c *conn, args []string) interface{} {
+	switch strings.ToLower(args[1]) {
+	case "load":
+		if len(args) != 3 {
+			return errArity("script|load")
+		}
+		sum := sha1.Sum([]byte(args[2]))
+		sha := hex.EncodeToString(sum[:])
+		c.server.scripts[sha] = struct{}{}
+		return sha
+	case "exists":
+		found := make([]interface{}, 0, len(args)-2)
+		for _, sha := range args[2:] {
+			_, ok := c.server.scripts[strings.ToLower(sha)]
+			if ok {
+				found = append(found, 1)
+			} else {
+				found = append(found, 0)
+			}
+		}
+		return found
+	case "flush":
+		c.server.scripts = map[string]struct{}{}
+		return ok
+	}
+	return errSyntax
+}
+
+func cmdEval(c *conn, args []string) interface{} {
+	if strings.EqualFold(args[0], "evalsha") {
+		if _, ok := c.server.scripts[strings.ToLower(args[1])]; !ok {
+			return errReply("NOSCRIPT No matching script. Please use EVAL.")
+		}
+	}
+	return errReply("ERR redistest does not run Lua scripts")
+}
+
+func cmdDBSize(c *conn, args []string) interface{} {
+	return len(c.server.db(c.db).liveKeys(c.server.now()))
+}
+
+func cmdFlushDB(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	for key := range d.keys {
+		d.del(key, c.server.now())
+	}
+	return ok
+}
+
+func cmdFlushAll(c *conn, args []string) interface{} {
+	for _, d := range c.server.dbs {
+		for key := range d.keys {
+			d.del(key, c.server.now())
+		}
+	}
+	return ok
+}
+
+func cmdGet(c *conn, args []string) interface{} {
+	e := c.server.db(c.db).get(args[1], c.server.now())
+	if e == nil {
+		return nil
+	}
+	if e.hash != nil {
+		return errWrongType
+	}
+	return e.str
+}
+
+func cmdSet(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	now := c.server.now()
+
+	var expireAt time.Time
+	var nx, xx, keepTTL bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "keepttl":
+			keepTTL = true
+		case "ex", "px":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return errReply("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToLower(args[i]) == "px" {
+				unit = time.Millisecond
+			}
+			expireAt = now.Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx {
+		return errSyntax
+	}
+
+	existing := d.get(args[1], now)
+	if (nx && existing != nil) || (xx && existing == nil) {
+		return nil
+	}
+	if keepTTL && existing != nil {
+		expireAt = existing.expireAt
+	}
+
+	d.set(args[1], &entry{str: args[2], expireAt: expireAt})
+	return ok
+}
+
+func cmdSetNX(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	if d.get(args[1], c.server.now()) != nil {
+		return 0
+	}
+	d.set(args[1], &entry{str: args[2]})
+	return 1
+}
+
+func cmdGetSet(c *conn, args []string) interface{} {
+	old := cmdGet(c, args[:2])
+	if _, wrong := old.(errReply); wrong {
+		return old
+	}
+	c.server.db(c.db).set(args[1], &entry{str: args[2]})
+	return old
+}
+
+func cmdGetEx(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	now := c.server.now()
+
+	e := d.get(args[1], now)
+	if e == nil {
+		return nil
+	}
+	if e.hash != nil {
+		return errWrongType
+	}
+
+	switch {
+	case len(args) == 2:
+	case len(args) == 3 && strings.ToLower(args[2]) == "persist":
+		e.expireAt = time.Time{}
+	case len(args) == 4:
+		n, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		switch strings.ToLower(args[2]) {
+		case "ex":
+			e.expireAt = now.Add(time.Duration(n) * time.Second)
+		case "px":
+			e.expireAt = now.Add(time.Duration(n) * time.Millisecond)
+		default:
+			return errSyntax
+		}
+	default:
+		return errSyntax
+	}
+	d.touch(args[1])
+
+	return e.str
+}
+
+func cmdMGet(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	values := make([]interface{}, 0, len(args)-1)
+	for _, key := range args[1:] {
+		e := d.get(key, c.server.now())
+		if e == nil || e.hash != nil {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, e.str)
+	}
+	return values
+}
+
+func cmdIncrBy(c *conn, args []string) interface{} {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	if strings.ToLower(args[0]) == "decrby" {
+		n = -n
+	}
+	return incrBy(c, args[1], n)
+}
+
+func incrBy(c *conn, key string, n int64) interface{} {
+	d := c.server.db(c.db)
+	e := d.get(key, c.server.now())
+	if e == nil {
+		e = &entry{str: "0"}
+	}
+	if e.hash != nil {
+		return errWrongType
+	}
+
+	value, err := strconv.ParseInt(e.str, 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	value += n
+	d.set(key, &entry{str: strconv.FormatInt(value, 10), expireAt: e.expireAt})
+
+	return value
+}
+
+func cmdExists(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	count := 0
+	for _, key := range args[1:] {
+		if d.get(key, c.server.now()) != nil {
+			count++
+		}
+	}
+	return count
+}
+
+func cmdDel(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	count := 0
+	for _, key := range args[1:] {
+		if d.del(key, c.server.now()) {
+			count++
+		}
+	}
+	return count
+}
+
+func cmdType(c *conn, args []string) interface{} {
+	e := c.server.db(c.db).get(args[1], c.server.now())
+	switch {
+	case e == nil:
+		return status("none")
+	case e.hash != nil:
+		return status("hash")
+	}
+	return status("string")
+}
+
+func cmdKeys(c *conn, args []string) interface{} {
+	keys := []string{}
+	for _, key := range c.server.db(c.db).liveKeys(c.server.now()) {
+		if redisutil.MatchGlob(args[1], key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// cmdScan walks the keys in creation order, the cursor is the id of the next
+// key to return.
+func cmdScan(c *conn, args []string) interface{} {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return errReply("ERR invalid cursor")
+	}
+
+	pattern := "*"
+	count := 10
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	d := c.server.db(c.db)
+	var entries []*entry
+	names := map[*entry]string{}
+	for _, key := range d.liveKeys(c.server.now()) {
+		e := d.keys[key]
+		if e.id >= cursor {
+			entries = append(entries, e)
+			names[e] = key
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+
+	matched := []string{}
+	next := uint64(0)
+	for i, e := range entries {
+		if i == count {
+			next = e.id
+			break
+		}
+		if redisutil.MatchGlob(pattern, names[e]) {
+			matched = append(matched, names[e])
+		}
+	}
+
+	return []interface{}{strconv.FormatUint(next, 10), matched}
+}
+
+func cmdTTL(c *conn, args []string) interface{} {
+	e := c.server.db(c.db).get(args[1], c.server.now())
+	switch {
+	case e == nil:
+		return -2
+	case e.expireAt.IsZero():
+		return -1
+	}
+
+	left := e.expireAt.Sub(c.server.now())
+	if strings.ToLower(args[0]) == "pttl" {
+		return int64(left / time.Millisecond)
+	}
+	return int64((left + time.Second/2) / time.Second)
+}
+
+func cmdExpire(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	now := c.server.now()
+
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	e := d.get(args[1], now)
+	if e == nil {
+		return 0
+	}
+
+	var expireAt time.Time
+	switch strings.ToLower(args[0]) {
+	case "expire":
+		expireAt = now.Add(time.Duration(n) * time.Second)
+	case "pexpire":
+		expireAt = now.Add(time.Duration(n) * time.Millisecond)
+	case "expireat":
+		expireAt = time.Unix(n, 0)
+	case "pexpireat":
+		expireAt = time.Unix(0, n*int64(time.Millisecond))
+	}
+
+	if !expireAt.After(now) {
+		d.del(args[1], now)
+		return 1
+	}
+	e.expireAt = expireAt
+	d.touch(args[1])
+
+	return 1
+}
+
+func cmdPersist(c *conn, args []string) interface{} {
+	d := c.server.db(c.db)
+	e := d.get(args[1], c.server.now())
+	if e == nil || e.expireAt.IsZero() {
+		return 0
+	}
+	e.expireAt = time.Time{}
+	d.touch(args[1])
+	return 1
+}
+
+func hashEntry(c *conn, key string, create bool) (*entry, interface{}) {
+	d := c.server.db(c.db)
+	e := d.get(key, c.server.now())
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		e = &entry{hash: map[string]string{}}
+		d.set(key, e)
+	}
+	if e.hash == nil {
+		return nil, errWrongType
+	}
+	return e, nil
+}
+
+func cmdHSet(c *conn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errArity("hset")
+	}
+	e, errR := hashEntry(c, args[1], true)
+	if errR != nil {
+		return errR
+	}
+
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		if _, exists := e.hash[args[i]]; !exists {
+			added++
+		}
+		e.hash[args[i]] = args[i+1]
+	}
+	c.server.db(c.db).touch(args[1])
+
+	return added
+}
+
+func cmdHGet(c *conn, args []string) interface{} {
+	e, errR := hashEntry(c, args[1], false)
+	if errR != nil || e == nil {
+		return errR
+	}
+	value, exists := e.hash[args[2]]
+	if !exists {
+		return nil
+	}
+	return value
+}
+
+func cmdHGetAll(c *conn, args []string) interface{} {
+	e, errR := hashEntry(c, args[1], false)
+	if errR != nil {
+		return errR
+	}
+	pairs := []string{}
+	if e != nil {
+		for field, value := range e.hash {
+			pairs = append(pairs, field, value)
+		}
+	}
+	return pairs
+}
+
+func cmdHDel(c *conn, args []string) interface{} {
+	e, errR := hashEntry(c, args[1], false)
+	if errR != nil {
+		return errR
+	}
+	if e == nil {
+		return 0
+	}
+
+	removed := 0
+	for _, field := range args[2:] {
+		if _, exists := e.hash[field]; exists {
+			delete(e.hash, field)
+			removed++
+		}
+	}
+	d := c.server.db(c.db)
+	if len(e.hash) == 0 {
+		d.del(args[1], c.server.now())
+	} else {
+		d.touch(args[1])
+	}
+
+	return removed
+}
+
+func cmdHExists(c *conn, args []string) interface{} {
+	e, errR := hashEntry(c, args[1], false)
+	if errR != nil {
+		return errR
+	}
+	if e == nil {
+		return 0
+	}
+	if _, exists := e.hash[args[2]]; exists {
+		return 1
+	}
+	return 0
+}
+
+func cmdHLen(c *conn, args []string) interface{} {
+	e, errR := hashEntry(c, args[1], false)
+	if errR != nil {
+		return errR
+	}
+	if e == nil {
+		return 0
+	}
+	return len(e.hash)
+}
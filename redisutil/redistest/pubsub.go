@@ -0,0 +1,83 @@
+package redistest
+
+import "github.com/vivasoft-ltd/golang-course-utils/redisutil"
+
+func (s *Server) subscribe(c *conn, pattern bool, names []string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kind, registry, own := "subscribe", s.channels, c.channels
+	if pattern {
+		kind, registry, own = "psubscribe", s.patterns, c.patterns
+	}
+
+	out := replies{}
+	for _, name := range names {
+		if registry[name] == nil {
+			registry[name] = map[*conn]struct{}{}
+		}
+		registry[name][c] = struct{}{}
+		own[name] = struct{}{}
+		out = append(out, []interface{}{kind, name, c.subscriptions()})
+	}
+
+	return out
+}
+
+func (s *Server) unsubscribe(c *conn, pattern bool, names []string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kind, registry, own := "unsubscribe", s.channels, c.channels
+	if pattern {
+		kind, registry, own = "punsubscribe", s.patterns, c.patterns
+	}
+
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []interface{}{kind, nil, c.subscriptions()}
+	}
+
+	out := replies{}
+	for _, name := range names {
+		delete(registry[name], c)
+		delete(own, name)
+		out = append(out, []interface{}{kind, name, c.subscriptions()})
+	}
+
+	return out
+}
+
+// publish delivers message outside the server lock so a slow subscriber
+// cannot stall other clients.
+func (s *Server) publish(channel, message string) interface{} {
+	type delivery struct {
+		conn  *conn
+		reply []interface{}
+	}
+
+	s.mu.Lock()
+	var deliveries []delivery
+	for c := range s.channels[channel] {
+		deliveries = append(deliveries, delivery{c, []interface{}{"message", channel, message}})
+	}
+	for pattern, conns := range s.patterns {
+		if !redisutil.MatchGlob(pattern, channel) {
+			continue
+		}
+		for c := range conns {
+			deliveries = append(deliveries, delivery{c, []interface{}{"pmessage", pattern, channel, message}})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range deliveries {
+		_ = d.conn.write(d.reply)
+	}
+
+	return len(deliveries)
+}
@@ -0,0 +1,147 @@
+package redistest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil/redistest"
+)
+
+func run(t *testing.T) (*redistest.Server, *redisutil.Redis) {
+	t.Helper()
+
+	s, err := redistest.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s.Connect("test:")
+	t.Cleanup(func() {
+		_ = r.Close()
+		_ = s.Close()
+	})
+
+	return s, r
+}
+
+func TestSetGet(t *testing.T) {
+	s, r := run(t)
+
+	if err := r.SetString("name", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Get("name")
+	if err != nil || got != "value" {
+		t.Fatalf("Get = %q, %v, want value", got, err)
+	}
+	if stored, ok := s.Get("test:name"); !ok || stored != "value" {
+		t.Fatalf("server holds %q, %v, want the prefixed key", stored, ok)
+	}
+
+	s.Set("test:other", "seeded")
+	if got, _ := r.Get("other"); got != "seeded" {
+		t.Fatalf("Get = %q, want seeded", got)
+	}
+}
+
+func TestTTLAndFastForward(t *testing.T) {
+	s, r := run(t)
+
+	if err := r.SetString("session", "x", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := s.TTL("test:session"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL = %v, want at most a minute", ttl)
+	}
+	if ttl, err := r.TTL("session"); err != nil || ttl <= 0 {
+		t.Fatalf("redisutil TTL = %v, %v", ttl, err)
+	}
+
+	s.FastForward(30 * time.Second)
+	if !r.HasKey("session") {
+		t.Fatal("key expired before its TTL")
+	}
+
+	s.FastForward(31 * time.Second)
+	if r.HasKey("session") {
+		t.Fatal("key outlived its TTL")
+	}
+	if _, ok := s.Get("test:session"); ok {
+		t.Fatal("server still holds the expired key")
+	}
+}
+
+func TestDelPattern(t *testing.T) {
+	s, r := run(t)
+
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		if err := r.SetString(key, "x", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Set("other:user:3", "x")
+
+	if err := r.DelPattern("user:*"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := s.Keys()
+	if strings.Join(keys, ",") != "other:user:3,test:order:1" {
+		t.Fatalf("keys left = %v", keys)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	_, r := run(t)
+
+	sub := r.Subscribe("events")
+	defer sub.Close()
+	if _, err := sub.Receive(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Publish("events", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-sub.Channel():
+		if r.StripPrefix(msg.Channel) != "events" || msg.Payload != "hello" {
+			t.Fatalf("received %s %q", msg.Channel, msg.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	_, r := run(t)
+
+	err := r.Transaction(context.Background(), []string{"counter"}, func(tx redisutil.Tx) error {
+		n, _ := tx.GetInt("counter")
+		tx.Set("counter", n+1, 0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := r.GetInt("counter"); err != nil || n != 1 {
+		t.Fatalf("counter = %d, %v, want 1", n, err)
+	}
+}
+
+func TestScriptsAreNotRun(t *testing.T) {
+	_, r := run(t)
+
+	if err := r.LoadScripts(); err != nil {
+		t.Fatalf("LoadScripts = %v", err)
+	}
+
+	script := redisutil.RegisterScript("redistest:test", "return 1")
+	if _, err := script.Run(r, nil); err == nil || !strings.Contains(err.Error(), "Lua") {
+		t.Fatalf("Run = %v, want the unsupported Lua error", err)
+	}
+}
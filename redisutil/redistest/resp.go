@@ -0,0 +1,57 @@
+package redistest
+
+import (
+	"bufio"
+	"strconv"
+)
+
+type status string
+
+type errReply string
+
+// replies are written one after the other, as the Pub/Sub commands do.
+type replies []interface{}
+
+type nilArray struct{}
+
+const (
+	ok            = status("OK")
+	errSyntax     = errReply("ERR syntax error")
+	errNotInteger = errReply("ERR value is not an integer or out of range")
+	errWrongType  = errReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+func errArity(name string) errReply {
+	return errReply("ERR wrong number of arguments for '" + name + "' command")
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case nilArray:
+		_, _ = w.WriteString("*-1\r\n")
+	case status:
+		_, _ = w.WriteString("+" + string(v) + "\r\n")
+	case errReply:
+		_, _ = w.WriteString("-" + string(v) + "\r\n")
+	case int:
+		_, _ = w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case string:
+		_, _ = w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case []string:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	case []interface{}:
+		_, _ = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	default:
+		writeReply(w, errReply("ERR redistest cannot encode reply"))
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Package redistest runs an in-process Redis stand-in speaking RESP on a random
+localhost port, so redisutil code paths can be exercised without a real
+server. It implements the string, key, TTL, hash, transaction and Pub/Sub
+commands used by this library; anything else replies with an error.
+
+It does not run Lua. SCRIPT LOAD caches scripts, so Connect preloads them
+without complaint, but EVAL and EVALSHA of a loaded script reply with an
+error. Code built on redisutil scripts, such as Semaphore, LeaderElection
+renewals, tags or the apikey quotas, needs a real server.
+*/
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+// Server is an in-memory Redis stand-in. All the exported helpers act on
+// database 0.
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	dbs      map[int]*db
+	offset   time.Duration
+	conns    map[*conn]struct{}
+	channels map[string]map[*conn]struct{}
+	patterns map[string]map[*conn]struct{}
+	config   map[string]string
+	scripts  map[string]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+type db struct {
+	keys     map[string]*entry
+	versions map[string]uint64
+	seq      uint64
+}
+
+type entry struct {
+	// id orders keys for SCAN, it is kept when a key is overwritten so that
+	// cursors stay valid while keys are written or deleted
+	id       uint64
+	str      string
+	hash     map[string]string
+	expireAt time.Time
+}
+
+// Run starts a server on a random localhost port.
+func Run() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		dbs:      map[int]*db{},
+		conns:    map[*conn]struct{}{},
+		channels: map[string]map[*conn]struct{}{},
+		patterns: map[string]map[*conn]struct{}{},
+		config:   map[string]string{},
+		scripts:  map[string]struct{}{},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// Connect returns a redisutil.Redis connected to s with prefix.
+func (s *Server) Connect(prefix string) *redisutil.Redis {
+	return redisutil.Connect(s.Host(), s.Port(), "", 0, prefix)
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	return port
+}
+
+// Close stops the server and drops every client connection.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		_ = c.netConn.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.wg.Wait()
+
+	return err
+}
+
+// FastForward moves the server clock forward by d, expiring the keys whose
+// TTL lapses in the meantime.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// Keys returns the live keys of database 0 in lexical order.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db(0).liveKeys(s.now())
+}
+
+// Get returns the string value stored at key.
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.db(0).get(key, s.now())
+	if e == nil || e.hash != nil {
+		return "", false
+	}
+
+	return e.str, true
+}
+
+// Set stores a string value at key without TTL.
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.db(0).set(key, &entry{str: value})
+}
+
+// TTL returns the remaining time to live of key, zero when key has no TTL or
+// does not exist.
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.db(0).get(key, s.now())
+	if e == nil || e.expireAt.IsZero() {
+		return 0
+	}
+
+	return e.expireAt.Sub(s.now())
+}
+
+// FlushAll removes every key of every database.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dbs = map[int]*db{}
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) db(i int) *db {
+	d, ok := s.dbs[i]
+	if !ok {
+		d = &db{
+			keys:     map[string]*entry{},
+			versions: map[string]uint64{},
+		}
+		s.dbs[i] = d
+	}
+	return d
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &conn{
+			server:   s,
+			netConn:  netConn,
+			writer:   bufio.NewWriter(netConn),
+			channels: map[string]struct{}{},
+			patterns: map[string]struct{}{},
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = netConn.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+		}()
+	}
+}
+
+func (d *db) get(key string, now time.Time) *entry {
+	e, ok := d.keys[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !e.expireAt.After(now) {
+		delete(d.keys, key)
+		d.versions[key]++
+		return nil
+	}
+	return e
+}
+
+func (d *db) set(key string, e *entry) {
+	if old, ok := d.keys[key]; ok {
+		e.id = old.id
+	} else {
+		d.seq++
+		e.id = d.seq
+	}
+	d.keys[key] = e
+	d.versions[key]++
+}
+
+func (d *db) del(key string, now time.Time) bool {
+	if d.get(key, now) == nil {
+		return false
+	}
+	delete(d.keys, key)
+	d.versions[key]++
+	return true
+}
+
+func (d *db) touch(key string) {
+	d.versions[key]++
+}
+
+func (d *db) liveKeys(now time.Time) []string {
+	keys := make([]string, 0, len(d.keys))
+	for key := range d.keys {
+		if d.get(key, now) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// conn is one client connection.
+type conn struct {
+	server  *Server
+	netConn net.Conn
+
+	writeMu sync.Mutex
+	writer  *bufio.Writer
+
+	db       int
+	multi    bool
+	queued   [][]string
+	watched  map[string]uint64
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (c *conn) serve() {
+	defer c.close()
+
+	reader := bufio.NewReader(c.netConn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		reply := c.server.dispatch(c, args)
+		if err := c.write(reply); err != nil {
+			return
+		}
+		if strings.EqualFold(args[0], "quit") {
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	s := c.server
+	s.mu.Lock()
+	delete(s.conns, c)
+	for ch := range c.channels {
+		delete(s.channels[ch], c)
+	}
+	for p := range c.patterns {
+		delete(s.patterns[p], c)
+	}
+	s.mu.Unlock()
+
+	_ = c.netConn.Close()
+}
+
+func (c *conn) write(reply interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if r, ok := reply.(replies); ok {
+		for _, item := range r {
+			writeReply(c.writer, item)
+		}
+	} else {
+		writeReply(c.writer, reply)
+	}
+
+	return c.writer.Flush()
+}
+
+func (c *conn) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+var errProtocol = errors.New("redistest: protocol error")
+
+// readCommand reads a RESP array of bulk strings or an inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, errProtocol
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errProtocol
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,196 @@
+package redisutil
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+// Config holds the connection settings of one named Redis.
+type Config struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	Prefix   string `json:"prefix"`
+}
+
+// Registry opens named Redis connections on first use, e.g. "cache",
+// "queue" and "session", and closes them all on shutdown.
+type Registry struct {
+	mu      sync.Mutex
+	configs map[string]Config
+	conns   map[string]*Redis
+	dialing map[string]*dialCall
+}
+
+// dialCall is a connection being opened, shared by the callers of Get
+// waiting for it.
+type dialCall struct {
+	done chan struct{}
+	r    *Redis
+	err  error
+}
+
+func NewRegistry(configs map[string]Config) *Registry {
+	return &Registry{
+		configs: configs,
+		conns:   map[string]*Redis{},
+		dialing: map[string]*dialCall{},
+	}
+}
+
+/*
+NewRegistryFromEnv reads the config of each name from the environment, e.g.
+for "cache": REDIS_CACHE_HOST, REDIS_CACHE_PORT, REDIS_CACHE_PASSWORD,
+REDIS_CACHE_DB and REDIS_CACHE_PREFIX. Port defaults to 6379.
+*/
+func NewRegistryFromEnv(names ...string) *Registry {
+	configs := map[string]Config{}
+	for _, name := range names {
+		env := "REDIS_" + strings.ToUpper(name) + "_"
+		db, _ := strconv.Atoi(os.Getenv(env + "DB"))
+		config := Config{
+			Host:     os.Getenv(env + "HOST"),
+			Port:     os.Getenv(env + "PORT"),
+			Password: os.Getenv(env + "PASSWORD"),
+			DB:       db,
+			Prefix:   os.Getenv(env + "PREFIX"),
+		}
+		if config.Port == "" {
+			config.Port = "6379"
+		}
+		configs[name] = config
+	}
+
+	return NewRegistry(configs)
+}
+
+// NewRegistryFromFile reads a JSON object mapping names to Config.
+func NewRegistryFromFile(path string) (*Registry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := map[string]Config{}
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, err
+	}
+
+	return NewRegistry(configs), nil
+}
+
+/*
+Get returns the connection called name, opening it on first use. Concurrent
+calls for a name being opened wait for that single dial, without blocking the
+calls for other names.
+*/
+func (g *Registry) Get(name string) (*Redis, error) {
+	g.mu.Lock()
+	if r, ok := g.conns[name]; ok {
+		g.mu.Unlock()
+		return r, nil
+	}
+	if call, ok := g.dialing[name]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.r, call.err
+	}
+
+	config, ok := g.configs[name]
+	if !ok {
+		g.mu.Unlock()
+		return nil, errutil.ErrRedisNotConfigured
+	}
+	call := &dialCall{done: make(chan struct{})}
+	g.dialing[name] = call
+	g.mu.Unlock()
+
+	call.r, call.err = Dial(config.Host, config.Port, config.Password, config.DB, config.Prefix)
+
+	g.mu.Lock()
+	delete(g.dialing, name)
+	if call.err == nil {
+		g.conns[name] = call.r
+	}
+	g.mu.Unlock()
+	close(call.done)
+
+	return call.r, call.err
+}
+
+// MustGet is like Get but panics when the connection cannot be opened.
+func (g *Registry) MustGet(name string) *Redis {
+	r, err := g.Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Names returns the configured names in lexical order.
+func (g *Registry) Names() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	names := make([]string, 0, len(g.configs))
+	for name := range g.configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Health pings every configured connection in parallel, opening it if needed,
+// and returns the failures by name. An empty map means every connection is
+// healthy.
+func (g *Registry) Health() map[string]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := map[string]error{}
+	for _, name := range g.Names() {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			r, err := g.Get(name)
+			if err == nil {
+				err = r.RedisClient.Ping().Err()
+			}
+			if err != nil {
+				mu.Lock()
+				failures[name] = err
+				mu.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	return failures
+}
+
+// Close closes every opened connection and returns the first error.
+func (g *Registry) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var firstErr error
+	for name, r := range g.conns {
+		if err := r.Close(); err != nil {
+			logger.Warn("failed to close redis ", name, ": ", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		delete(g.conns, name)
+	}
+
+	return firstErr
+}
@@ -0,0 +1,198 @@
+package redisutil
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+type ReplicaStrategy int
+
+const (
+	// RoundRobin spreads reads evenly over the healthy replicas.
+	RoundRobin ReplicaStrategy = iota
+	// LowestLatency sends reads to the healthy replica with the fastest ping.
+	LowestLatency
+)
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	// replicaCloseDelay lets reads in flight on replaced replicas finish
+	replicaCloseDelay = 30 * time.Second
+)
+
+// ReplicaOptions configures read replicas. Addrs are host:port pairs, the
+// password and db of the primary are used when Password is empty.
+type ReplicaOptions struct {
+	Addrs          []string
+	Password       string
+	Strategy       ReplicaStrategy
+	HealthInterval time.Duration
+}
+
+type replica struct {
+	addr    string
+	client  *redis.Client
+	healthy int32
+	latency int64
+}
+
+type replicaSet struct {
+	strategy ReplicaStrategy
+	replicas []*replica
+	next     uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+/*
+UseReplicas routes the read helpers Get, GetInt, GetStruct, HasKey and Exists
+to the replicas in opts. Replicas are pinged in the background and skipped
+while unhealthy, reads go to the primary when no replica is healthy. Use
+Primary for reads that must see the caller's own writes.
+
+It may be called again while r is in use to change the replicas, the
+connections to the previous ones being closed once their reads are done.
+*/
+func (r *Redis) UseReplicas(opts ReplicaOptions) {
+	primary := r.RedisClient.Options()
+	if opts.Password == "" {
+		opts.Password = primary.Password
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = defaultHealthInterval
+	}
+
+	set := &replicaSet{
+		strategy: opts.Strategy,
+		stop:     make(chan struct{}),
+	}
+	for _, addr := range opts.Addrs {
+		rep := &replica{
+			addr: addr,
+			client: redis.NewClient(&redis.Options{
+				Addr:     addr,
+				Password: opts.Password,
+				DB:       primary.DB,
+			}),
+		}
+		rep.check()
+		set.replicas = append(set.replicas, rep)
+	}
+
+	go set.healthCheck(opts.HealthInterval)
+	if old := r.replicas.Swap(set); old != nil {
+		old.close(replicaCloseDelay)
+	}
+}
+
+// Primary returns a view of r whose reads always go to the primary.
+func (r *Redis) Primary() *Redis {
+	return &Redis{
+		Prefix:       r.Prefix,
+		RedisClient:  r.RedisClient,
+		TTLJitter:    r.TTLJitter,
+		forcePrimary: true,
+		encryption:   r.encryption,
+	}
+}
+
+// Close stops the replica health checks and closes every connection.
+func (r *Redis) Close() error {
+	if set := r.replicas.Swap(nil); set != nil {
+		set.close(0)
+	}
+	return r.RedisClient.Close()
+}
+
+// reader returns the client used by the read helpers.
+func (r *Redis) reader() *redis.Client {
+	set := r.replicas.Load()
+	if r.forcePrimary || set == nil {
+		return r.RedisClient
+	}
+	if rep := set.pick(); rep != nil {
+		return rep.client
+	}
+	return r.RedisClient
+}
+
+// close stops the health checks and closes the replica connections after
+// delay.
+func (s *replicaSet) close(delay time.Duration) {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		closeClients := func() {
+			for _, rep := range s.replicas {
+				_ = rep.client.Close()
+			}
+		}
+		if delay <= 0 {
+			closeClients()
+			return
+		}
+		time.AfterFunc(delay, closeClients)
+	})
+}
+
+func (s *replicaSet) pick() *replica {
+	var healthy []*replica
+	for _, rep := range s.replicas {
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			healthy = append(healthy, rep)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if s.strategy == LowestLatency {
+		best := healthy[0]
+		for _, rep := range healthy[1:] {
+			if atomic.LoadInt64(&rep.latency) < atomic.LoadInt64(&best.latency) {
+				best = rep
+			}
+		}
+		return best
+	}
+
+	n := atomic.AddUint64(&s.next, 1)
+	return healthy[n%uint64(len(healthy))]
+}
+
+func (s *replicaSet) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			for _, rep := range s.replicas {
+				rep.check()
+			}
+		}
+	}
+}
+
+func (rep *replica) check() {
+	start := time.Now()
+	err := rep.client.Ping().Err()
+	atomic.StoreInt64(&rep.latency, int64(time.Since(start)))
+
+	healthy := int32(1)
+	if err != nil {
+		healthy = 0
+	}
+	if old := atomic.SwapInt32(&rep.healthy, healthy); old != healthy {
+		if healthy == 1 {
+			logger.Info("redis replica ", rep.addr, " is healthy")
+		} else {
+			logger.Warn("redis replica ", rep.addr, " is unhealthy: ", err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package redisutil
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+// UpgradeFunc migrates a payload from one schema version to the next.
+type UpgradeFunc func(old json.RawMessage) (json.RawMessage, error)
+
+// Schema is the current version of a cached struct type together with the
+// upgrades from its older versions.
+type Schema struct {
+	Name    string
+	Version int
+	// WriteBack stores upgraded payloads so the upgrade runs only once.
+	WriteBack bool
+
+	upgrades map[int]UpgradeFunc
+}
+
+// versioned is the envelope stored by SetVersioned.
+type versioned struct {
+	Version int             `json:"_v"`
+	Data    json.RawMessage `json:"data"`
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = map[reflect.Type]*Schema{}
+
+	schemaMismatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vivasoft",
+		Subsystem: "redisutil",
+		Name:      "schema_mismatch_total",
+		Help:      "Cached payloads read with an outdated schema version, by result.",
+	}, []string{"schema", "version", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(schemaMismatches)
+}
+
+/*
+RegisterSchema declares version as the current schema version of the type of
+value, a struct or a pointer to one. Payloads cached before versioning was
+introduced are version 0.
+*/
+func RegisterSchema(value interface{}, version int) *Schema {
+	t := schemaType(value)
+	schema := &Schema{
+		Name:     t.String(),
+		Version:  version,
+		upgrades: map[int]UpgradeFunc{},
+	}
+
+	schemasMu.Lock()
+	schemas[t] = schema
+	schemasMu.Unlock()
+
+	return schema
+}
+
+// Upgrade registers fn to migrate payloads from version from to from+1.
+func (s *Schema) Upgrade(from int, fn UpgradeFunc) *Schema {
+	s.upgrades[from] = fn
+	return s
+}
+
+// SetVersioned stores value like SetStruct, tagged with the current version
+// of its registered schema.
+func (r *Redis) SetVersioned(key string, value interface{}, ttl time.Duration) error {
+	schema, err := lookupSchema(value)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return r.SetStruct(key, versioned{Version: schema.Version, Data: data}, ttl)
+}
+
+/*
+GetVersioned reads a value stored by SetVersioned into outputStruct. Older
+payloads are upgraded step by step; payloads that cannot be upgraded, or come
+from a newer version, are reported as a miss with redis.Nil.
+*/
+func (r *Redis) GetVersioned(key string, outputStruct interface{}) error {
+	schema, err := lookupSchema(outputStruct)
+	if err != nil {
+		return err
+	}
+
+	raw, err := r.Get(key)
+	if err != nil {
+		return err
+	}
+
+	probe := struct {
+		Version *int            `json:"_v"`
+		Data    json.RawMessage `json:"data"`
+	}{}
+	envelope := versioned{Version: 0, Data: json.RawMessage(raw)}
+	if err := json.Unmarshal([]byte(raw), &probe); err == nil && probe.Version != nil && probe.Data != nil {
+		envelope = versioned{Version: *probe.Version, Data: probe.Data}
+	}
+
+	if envelope.Version != schema.Version {
+		data, ok := schema.upgrade(envelope)
+		if !ok {
+			schemaMismatches.WithLabelValues(schema.Name, strconv.Itoa(envelope.Version), "miss").Inc()
+			return redis.Nil
+		}
+		schemaMismatches.WithLabelValues(schema.Name, strconv.Itoa(envelope.Version), "upgraded").Inc()
+		envelope = versioned{Version: schema.Version, Data: data}
+
+		if schema.WriteBack {
+			r.writeBack(key, raw, envelope)
+		}
+	}
+
+	return json.Unmarshal(envelope.Data, outputStruct)
+}
+
+func (s *Schema) upgrade(envelope versioned) (json.RawMessage, bool) {
+	if envelope.Version > s.Version {
+		return nil, false
+	}
+
+	data := envelope.Data
+	for v := envelope.Version; v < s.Version; v++ {
+		fn, ok := s.upgrades[v]
+		if !ok {
+			return nil, false
+		}
+
+		var err error
+		if data, err = fn(data); err != nil {
+			logger.Warn("failed to upgrade cached ", s.Name, " from version ", v, ": ", err)
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+/*
+writeBack stores the upgraded payload of raw, keeping the remaining TTL as is.
+The key is watched so that a value written since raw was read is never
+replaced by the upgrade of the stale one.
+*/
+func (r *Redis) writeBack(key, raw string, envelope versioned) {
+	key = r.getKey(key)
+	storedValue, err := r.encode(key, envelope)
+	if err != nil {
+		logger.Warn("failed to write back upgraded cache key ", key, ": ", err)
+		return
+	}
+
+	err = r.RedisClient.Watch(func(rtx *redis.Tx) error {
+		current, err := rtx.Get(key).Result()
+		if err != nil {
+			return err
+		}
+		if current, err = r.decrypt(key, current); err != nil || current != raw {
+			return err
+		}
+
+		ttl, err := rtx.PTTL(key).Result()
+		if err != nil {
+			return err
+		}
+		if ttl < 0 {
+			// no TTL, a missing key was caught by GET
+			ttl = 0
+		}
+
+		_, err = rtx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, storedValue, ttl)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil && err != redis.Nil && err != redis.TxFailedErr {
+		logger.Warn("failed to write back upgraded cache key ", key, ": ", err)
+	}
+}
+
+func lookupSchema(value interface{}) (*Schema, error) {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	schema, ok := schemas[schemaType(value)]
+	if !ok {
+		return nil, errutil.ErrSchemaNotRegistered
+	}
+
+	return schema, nil
+}
+
+func schemaType(value interface{}) reflect.Type {
+	t := reflect.TypeOf(value)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,131 @@
+package redisutil
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+)
+
+// Script is a named Lua script run with EVALSHA. KEYS passed to Run are
+// prefixed with Redis.Prefix, ARGV are passed as is.
+type Script struct {
+	Name string
+	Src  string
+	sha  string
+}
+
+var (
+	scriptsMu sync.RWMutex
+	scripts   = map[string]*Script{}
+)
+
+// RegisterScript adds src to the script registry under name and returns it.
+// Registering a name twice replaces the previous script.
+func RegisterScript(name, src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	script := &Script{
+		Name: name,
+		Src:  src,
+		sha:  hex.EncodeToString(sum[:]),
+	}
+
+	scriptsMu.Lock()
+	scripts[name] = script
+	scriptsMu.Unlock()
+
+	return script
+}
+
+/*
+RegisterScriptFS registers every file of fsys matching pattern, typically an
+embed.FS and "scripts/*.lua". Scripts are named after their file name without
+extension.
+*/
+func RegisterScriptFS(fsys fs.FS, pattern string) error {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		src, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+		RegisterScript(name, string(src))
+	}
+
+	return nil
+}
+
+// GetScript returns the registered script called name.
+func GetScript(name string) (*Script, error) {
+	scriptsMu.RLock()
+	defer scriptsMu.RUnlock()
+
+	script, ok := scripts[name]
+	if !ok {
+		return nil, errutil.ErrScriptNotFound
+	}
+
+	return script, nil
+}
+
+// SHA returns the SHA1 digest used to call the script with EVALSHA.
+func (s *Script) SHA() string {
+	return s.sha
+}
+
+// Run executes the script on r with EVALSHA, falling back to EVAL when the
+// script is not cached by the server yet.
+func (s *Script) Run(r *Redis, keys []string, args ...interface{}) (interface{}, error) {
+	keys = r.getKeys(keys)
+
+	res, err := r.RedisClient.EvalSha(s.sha, keys, args...).Result()
+	if err != nil && isNoScript(err) {
+		return r.RedisClient.Eval(s.Src, keys, args...).Result()
+	}
+
+	return res, err
+}
+
+// RunScript runs the registered script called name, see Script.Run.
+func (r *Redis) RunScript(name string, keys []string, args ...interface{}) (interface{}, error) {
+	script, err := GetScript(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return script.Run(r, keys, args...)
+}
+
+// LoadScripts loads every registered script into the server script cache,
+// going on past failures, and returns the first error. Connect calls it, call
+// it again after registering scripts later on.
+func (r *Redis) LoadScripts() error {
+	scriptsMu.RLock()
+	defer scriptsMu.RUnlock()
+
+	var firstErr error
+	for name, script := range scripts {
+		if err := r.RedisClient.ScriptLoad(script.Src).Err(); err != nil {
+			logger.Warn("failed to load redis script ", name, ": ", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func isNoScript(err error) bool {
+	return strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
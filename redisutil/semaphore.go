@@ -0,0 +1,124 @@
+package redisutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+const semaphorePollInterval = 50 * time.Millisecond
+
+/*
+semaphoreAcquire takes a slot for ARGV[1] when fewer than ARGV[2] holders
+remain after dropping expired ones and every waiter queued before ARGV[1] has
+been served.
+
+KEYS: holders zset (score = expiry ms), queue zset (score = ticket),
+waiters hash (id -> poll deadline ms), ticket counter.
+ARGV: id, limit, now ms, ttl ms, waiter ttl ms.
+*/
+var semaphoreAcquire = RegisterScript("redisutil:semaphore:acquire", `
+local now = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+local waiters = redis.call('HGETALL', KEYS[3])
+for i = 1, #waiters, 2 do
+	if tonumber(waiters[i + 1]) < now then
+		redis.call('HDEL', KEYS[3], waiters[i])
+		redis.call('ZREM', KEYS[2], waiters[i])
+	end
+end
+
+if not redis.call('ZSCORE', KEYS[2], ARGV[1]) then
+	redis.call('ZADD', KEYS[2], redis.call('INCR', KEYS[4]), ARGV[1])
+end
+
+local idle = math.max(tonumber(ARGV[4]), tonumber(ARGV[5])) * 2
+for i = 1, 4 do
+	redis.call('PEXPIRE', KEYS[i], idle)
+end
+
+local free = tonumber(ARGV[2]) - redis.call('ZCARD', KEYS[1])
+if redis.call('ZRANK', KEYS[2], ARGV[1]) < free then
+	redis.call('ZADD', KEYS[1], now + tonumber(ARGV[4]), ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('HDEL', KEYS[3], ARGV[1])
+	return 1
+end
+
+redis.call('HSET', KEYS[3], ARGV[1], now + tonumber(ARGV[5]))
+return 0
+`)
+
+/*
+Acquire blocks until it holds one of the limit slots of the semaphore name or
+ctx is done. Waiters are served in FIFO order. The slot is released by
+Release or, if the holder crashes, once ttl has passed. It returns the holder
+ID to pass to Release.
+*/
+func (r *Redis) Acquire(ctx context.Context, name string, limit int, ttl time.Duration) (string, error) {
+	if utils.IsEmpty(name) || limit < 1 || ttl <= 0 {
+		return "", errutil.ErrInvalidSemaphore
+	}
+
+	id, err := newHolderID()
+	if err != nil {
+		return "", err
+	}
+
+	keys := semaphoreKeys(name)
+	// a waiter that stops polling for a few intervals loses its place
+	waiterTTL := 10 * semaphorePollInterval
+
+	ticker := time.NewTicker(semaphorePollInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		res, err := semaphoreAcquire.Run(r, keys, id, limit, now, ttl.Milliseconds(), waiterTTL.Milliseconds())
+		if err != nil {
+			return "", err
+		}
+		if acquired, _ := res.(int64); acquired == 1 {
+			return id, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = r.Release(name, id)
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Release frees the slot of holderID in the semaphore name, or its place in
+// the queue when it is still waiting.
+func (r *Redis) Release(name, holderID string) error {
+	keys := r.getKeys(semaphoreKeys(name))
+
+	pipe := r.RedisClient.TxPipeline()
+	pipe.ZRem(keys[0], holderID)
+	pipe.ZRem(keys[1], holderID)
+	pipe.HDel(keys[2], holderID)
+	_, err := pipe.Exec()
+
+	return err
+}
+
+func semaphoreKeys(name string) []string {
+	base := "semaphore:" + name
+	return []string{base + ":holders", base + ":queue", base + ":waiters", base + ":ticket"}
+}
+
+func newHolderID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
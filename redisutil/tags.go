@@ -0,0 +1,88 @@
+package redisutil
+
+import (
+	"time"
+
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+/*
+tagAdd adds ARGV[1] to the tag set KEYS[1] and extends the set TTL to ARGV[2]
+milliseconds when that is longer, 0 making the set persistent.
+*/
+var tagAdd = RegisterScript("redisutil:tags:add", `
+local created = redis.call('EXISTS', KEYS[1]) == 0
+redis.call('SADD', KEYS[1], ARGV[1])
+
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	return redis.call('PERSIST', KEYS[1])
+end
+
+local current = redis.call('PTTL', KEYS[1])
+if created or (current >= 0 and current < ttl) then
+	return redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 0
+`)
+
+/*
+SetWithTags stores value like Set and records key under each tag so that
+InvalidateTags can delete every key of a tag at once. A tag set lives as long
+as the longest TTL written under it.
+*/
+func (r *Redis) SetWithTags(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	prefixedKey := r.getKey(key)
+	if utils.IsEmpty(prefixedKey) || utils.IsEmpty(value) {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	storedValue, err := r.encode(prefixedKey, value)
+	if err != nil {
+		return err
+	}
+
+	// the key and its tag sets share one jittered TTL so no set expires first
+	ttl = r.expiration(ttl)
+	if err := r.RedisClient.Set(prefixedKey, storedValue, ttl).Err(); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := tagAdd.Run(r, []string{tagSetKey(tag)}, key, ttl.Milliseconds()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InvalidateTags deletes every key stored under the tags, then the tags.
+func (r *Redis) InvalidateTags(tags ...string) error {
+	if len(tags) == 0 {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	for _, tag := range tags {
+		if utils.IsEmpty(tag) {
+			return errutil.ErrEmptyRedisKeyValue
+		}
+
+		tagKey := r.getKey(tagSetKey(tag))
+		keys, err := r.RedisClient.SMembers(tagKey).Result()
+		if err != nil {
+			return err
+		}
+
+		if err := r.Del(append(keys, tagSetKey(tag))...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tagSetKey(tag string) string {
+	return "tag:" + tag
+}
@@ -0,0 +1,192 @@
+package redisutil
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	utils "github.com/vivasoft-ltd/golang-course-utils/methods"
+)
+
+const (
+	TTLPersistent time.Duration = -1
+	TTLMissing    time.Duration = -2
+)
+
+// SetNX sets key to value only if key does not exist. It returns true if the
+// value was written.
+func (r *Redis) SetNX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || utils.IsEmpty(value) {
+		return false, errutil.ErrEmptyRedisKeyValue
+	}
+
+	storedValue, err := r.encode(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	return r.RedisClient.SetNX(key, storedValue, r.expiration(ttl)).Result()
+}
+
+// SetXX sets key to value only if key already exists. It returns true if the
+// value was written.
+func (r *Redis) SetXX(key string, value interface{}, ttl time.Duration) (bool, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || utils.IsEmpty(value) {
+		return false, errutil.ErrEmptyRedisKeyValue
+	}
+
+	storedValue, err := r.encode(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	return r.RedisClient.SetXX(key, storedValue, r.expiration(ttl)).Result()
+}
+
+// SetKeepTTL overwrites the value of key without touching its TTL.
+// Requires Redis 6.0 or newer.
+func (r *Redis) SetKeepTTL(key string, value interface{}) error {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || utils.IsEmpty(value) {
+		return errutil.ErrEmptyRedisKeyValue
+	}
+
+	storedValue, err := r.encode(key, value)
+	if err != nil {
+		return err
+	}
+
+	return r.RedisClient.Do("set", key, storedValue, "keepttl").Err()
+}
+
+// GetSet sets key to value and returns the previous value. The TTL of key is
+// removed, as with the GETSET command.
+func (r *Redis) GetSet(key string, value interface{}) (string, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) || utils.IsEmpty(value) {
+		return "", errutil.ErrEmptyRedisKeyValue
+	}
+
+	storedValue, err := r.encode(key, value)
+	if err != nil {
+		return "", err
+	}
+
+	previous, err := r.RedisClient.GetSet(key, storedValue).Result()
+	if err != nil {
+		return "", err
+	}
+
+	return r.decrypt(key, previous)
+}
+
+// GetEx returns the value of key and sets its TTL to ttl, a zero ttl removes
+// the TTL. Requires Redis 6.2 or newer, see Touch for older servers.
+func (r *Redis) GetEx(key string, ttl time.Duration) (string, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return "", errutil.ErrEmptyRedisKeyValue
+	}
+
+	args := []interface{}{"getex", key, "persist"}
+	if ttl > 0 {
+		args = []interface{}{"getex", key, "px", int64(r.expiration(ttl) / time.Millisecond)}
+	}
+
+	cmd := redis.NewStringCmd(args...)
+	_ = r.RedisClient.Process(cmd)
+	value, err := cmd.Result()
+	if err != nil {
+		return "", err
+	}
+
+	return r.decrypt(key, value)
+}
+
+// Touch returns the value of key and extends its TTL to ttl in the same round
+// trip, a ttl of zero or less removes the TTL as with GetEx. Unlike GetEx it
+// works on every Redis version.
+func (r *Redis) Touch(key string, ttl time.Duration) (string, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return "", errutil.ErrEmptyRedisKeyValue
+	}
+
+	var get *redis.StringCmd
+	_, err := r.RedisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		if ttl > 0 {
+			pipe.PExpire(key, r.expiration(ttl))
+		} else {
+			pipe.Persist(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return r.decrypt(key, get.Val())
+}
+
+// TTL returns the remaining time to live of key, or TTLPersistent and
+// TTLMissing for keys without TTL and missing keys.
+func (r *Redis) TTL(key string) (time.Duration, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return 0, errutil.ErrEmptyRedisKeyValue
+	}
+
+	ttl, err := r.RedisClient.PTTL(key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		// go-redis scales the -1/-2 replies by the command precision
+		return ttl / time.Millisecond, nil
+	}
+
+	return ttl, nil
+}
+
+// Expire sets the TTL of key. A ttl of zero or less removes the TTL like
+// Persist instead of deleting the key as PEXPIRE would. It returns false if
+// key does not exist.
+func (r *Redis) Expire(key string, ttl time.Duration) (bool, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return false, errutil.ErrEmptyRedisKeyValue
+	}
+	if ttl <= 0 {
+		if err := r.RedisClient.Persist(key).Err(); err != nil {
+			return false, err
+		}
+		exists, err := r.RedisClient.Exists(key).Result()
+		return exists == 1, err
+	}
+
+	return r.RedisClient.PExpire(key, r.expiration(ttl)).Result()
+}
+
+// Persist removes the TTL of key. It returns false if key does not exist or
+// has no TTL.
+func (r *Redis) Persist(key string) (bool, error) {
+	key = r.getKey(key)
+	if utils.IsEmpty(key) {
+		return false, errutil.ErrEmptyRedisKeyValue
+	}
+
+	return r.RedisClient.Persist(key).Result()
+}
+
+// expiration applies TTLJitter to ttl. Non positive ttl are returned as is.
+func (r *Redis) expiration(ttl time.Duration) time.Duration {
+	if ttl <= 0 || r.TTLJitter <= 0 {
+		return ttl
+	}
+
+	return ttl + time.Duration(rand.Int63n(int64(float64(ttl)*r.TTLJitter)+1))
+}
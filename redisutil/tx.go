@@ -0,0 +1,215 @@
+package redisutil
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+)
+
+const (
+	txMaxRetries = 10
+	txMinBackoff = 5 * time.Millisecond
+	txMaxBackoff = 500 * time.Millisecond
+)
+
+// Tx is the view of an optimistic transaction handed to Transaction. Reads
+// run immediately against the watched keys, writes are queued and applied
+// atomically with MULTI/EXEC once the callback returns. Keys are prefixed.
+type Tx interface {
+	Get(key string) (string, error)
+	GetInt(key string) (int, error)
+	GetStruct(key string, outputStruct interface{}) error
+	HGetStruct(key, field string, outputStruct interface{}) error
+	Exists(key string) bool
+
+	Set(key string, value interface{}, ttl time.Duration)
+	SetString(key string, value string, ttl time.Duration)
+	HSetStruct(key, field string, value interface{})
+	IncBy(key string, value int)
+	// Expire removes the TTL of key when ttl is zero or less, like
+	// Redis.Expire.
+	Expire(key string, ttl time.Duration)
+	Del(keys ...string)
+}
+
+type tx struct {
+	r      *Redis
+	client *redis.Tx
+	writes []func(pipe redis.Pipeliner)
+	// err is the first error met while queueing writes, it aborts the
+	// transaction before EXEC
+	err error
+}
+
+/*
+Transaction watches keys, runs fn and applies the writes it queued only if
+none of the watched keys changed in the meantime. Conflicts are retried with
+a bounded exponential backoff, errutil.ErrTxRetriesExhausted is returned once
+the retries are used up. An error returned by fn aborts the transaction and is
+returned as is, as is an error met while queueing a write, such as a value that
+cannot be marshalled.
+*/
+func (r *Redis) Transaction(ctx context.Context, keys []string, fn func(tx Tx) error) error {
+	client := r.RedisClient.WithContext(ctx)
+	backoff := txMinBackoff
+
+	for attempt := 0; attempt < txMaxRetries; attempt++ {
+		err := client.Watch(func(rtx *redis.Tx) error {
+			t := &tx{r: r, client: rtx}
+			if err := fn(t); err != nil {
+				return err
+			}
+			if t.err != nil {
+				return t.err
+			}
+			if len(t.writes) == 0 {
+				return nil
+			}
+
+			_, err := rtx.TxPipelined(func(pipe redis.Pipeliner) error {
+				for _, write := range t.writes {
+					write(pipe)
+				}
+				return nil
+			})
+			return err
+		}, r.getKeys(keys)...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))):
+		}
+		if backoff *= 2; backoff > txMaxBackoff {
+			backoff = txMaxBackoff
+		}
+	}
+
+	return errutil.ErrTxRetriesExhausted
+}
+
+func (t *tx) Get(key string) (string, error) {
+	key = t.r.getKey(key)
+	value, err := t.client.Get(key).Result()
+	if err != nil {
+		return "", err
+	}
+
+	return t.r.decrypt(key, value)
+}
+
+func (t *tx) GetInt(key string) (int, error) {
+	str, err := t.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(str)
+}
+
+func (t *tx) GetStruct(key string, outputStruct interface{}) error {
+	serializedValue, err := t.Get(key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(serializedValue), outputStruct)
+}
+
+func (t *tx) HGetStruct(key, field string, outputStruct interface{}) error {
+	key = t.r.getKey(key)
+	serializedValue, err := t.client.HGet(key, field).Result()
+	if err != nil {
+		return err
+	}
+	if serializedValue, err = t.r.decrypt(hashFieldKey(key, field), serializedValue); err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(serializedValue), outputStruct)
+}
+
+func (t *tx) Exists(key string) bool {
+	exists, err := t.client.Exists(t.r.getKey(key)).Result()
+	return err == nil && exists == 1
+}
+
+func (t *tx) Set(key string, value interface{}, ttl time.Duration) {
+	serializedValue, err := json.Marshal(value)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	t.SetString(key, string(serializedValue), ttl)
+}
+
+func (t *tx) SetString(key string, value string, ttl time.Duration) {
+	key = t.r.getKey(key)
+	storedValue, err := t.r.encrypt(key, value)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+
+	ttl = t.r.expiration(ttl)
+	t.writes = append(t.writes, func(pipe redis.Pipeliner) {
+		pipe.Set(key, storedValue, ttl)
+	})
+}
+
+func (t *tx) HSetStruct(key, field string, value interface{}) {
+	key = t.r.getKey(key)
+	storedValue, err := t.r.encode(hashFieldKey(key, field), value)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+
+	t.writes = append(t.writes, func(pipe redis.Pipeliner) {
+		pipe.HSet(key, field, storedValue)
+	})
+}
+
+func (t *tx) IncBy(key string, value int) {
+	key = t.r.getKey(key)
+	t.writes = append(t.writes, func(pipe redis.Pipeliner) {
+		pipe.IncrBy(key, int64(value))
+	})
+}
+
+func (t *tx) Expire(key string, ttl time.Duration) {
+	key = t.r.getKey(key)
+	if ttl <= 0 {
+		t.writes = append(t.writes, func(pipe redis.Pipeliner) {
+			pipe.Persist(key)
+		})
+		return
+	}
+
+	ttl = t.r.expiration(ttl)
+	t.writes = append(t.writes, func(pipe redis.Pipeliner) {
+		pipe.PExpire(key, ttl)
+	})
+}
+
+func (t *tx) Del(keys ...string) {
+	keys = t.r.getKeys(keys)
+	t.writes = append(t.writes, func(pipe redis.Pipeliner) {
+		pipe.Del(keys...)
+	})
+}
+
+// fail records the first error met while queueing writes.
+func (t *tx) fail(err error) {
+	if t.err == nil {
+		t.err = err
+	}
+}
@@ -0,0 +1,197 @@
+package warmup
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vivasoft-ltd/golang-course-utils/errutil"
+	"github.com/vivasoft-ltd/golang-course-utils/logger"
+	"github.com/vivasoft-ltd/golang-course-utils/redisutil"
+)
+
+// batchSize is the number of entries written per pipeline.
+const batchSize = 500
+
+// Loader produces the entries to preload into the cache.
+type Loader func(ctx context.Context) ([]redisutil.Entry, error)
+
+// Result reports the outcome of one loader.
+type Result struct {
+	Name     string
+	Keys     int
+	Duration time.Duration
+	Err      error
+}
+
+// Runner runs the registered loaders in parallel and writes what they
+// produce through redisutil.
+type Runner struct {
+	redis       *redisutil.Redis
+	concurrency int
+
+	mu      sync.RWMutex
+	loaders map[string]Loader
+}
+
+var (
+	warmupKeys = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vivasoft",
+		Subsystem: "warmup",
+		Name:      "keys_total",
+		Help:      "Cache keys written by warm-up loaders.",
+	}, []string{"loader"})
+	warmupFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vivasoft",
+		Subsystem: "warmup",
+		Name:      "failures_total",
+		Help:      "Warm-up loaders that failed.",
+	}, []string{"loader"})
+	warmupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "vivasoft",
+		Subsystem: "warmup",
+		Name:      "duration_seconds",
+		Help:      "Time taken by warm-up loaders, writes included.",
+	}, []string{"loader"})
+)
+
+func init() {
+	prometheus.MustRegister(warmupKeys, warmupFailures, warmupDuration)
+}
+
+// NewRunner returns a runner executing at most concurrency loaders at once.
+func NewRunner(r *redisutil.Redis, concurrency int) *Runner {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Runner{
+		redis:       r,
+		concurrency: concurrency,
+		loaders:     map[string]Loader{},
+	}
+}
+
+// Register adds loader under name, replacing any loader of the same name.
+func (w *Runner) Register(name string, loader Loader) {
+	w.mu.Lock()
+	w.loaders[name] = loader
+	w.mu.Unlock()
+}
+
+// RunAll runs every registered loader, typically at startup.
+func (w *Runner) RunAll(ctx context.Context) ([]Result, error) {
+	w.mu.RLock()
+	names := make([]string, 0, len(w.loaders))
+	for name := range w.loaders {
+		names = append(names, name)
+	}
+	w.mu.RUnlock()
+	sort.Strings(names)
+
+	return w.Run(ctx, names...)
+}
+
+/*
+Run runs the named loaders on demand. A failing loader does not stop the
+others; the results of every loader are returned in the order of names along
+with errutil.ErrWarmupFailed if any of them failed.
+*/
+func (w *Runner) Run(ctx context.Context, names ...string) ([]Result, error) {
+	results := make([]Result, len(names))
+	sem := make(chan struct{}, w.concurrency)
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = w.runLoader(ctx, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var err error
+	failed := 0
+	for _, res := range results {
+		if res.Err != nil {
+			failed++
+			err = errutil.ErrWarmupFailed
+		}
+	}
+	logger.InfoWithFields("cache warm-up finished", map[string]interface{}{
+		"loaders": len(names),
+		"failed":  failed,
+	})
+
+	return results, err
+}
+
+func (w *Runner) runLoader(ctx context.Context, name string) Result {
+	start := time.Now()
+	res := Result{Name: name}
+
+	w.mu.RLock()
+	loader, ok := w.loaders[name]
+	w.mu.RUnlock()
+
+	if !ok {
+		res.Err = errutil.ErrLoaderNotFound
+	} else if err := ctx.Err(); err != nil {
+		res.Err = err
+	} else {
+		res.Keys, res.Err = w.load(ctx, loader)
+	}
+	res.Duration = time.Since(start)
+
+	warmupKeys.WithLabelValues(name).Add(float64(res.Keys))
+	warmupDuration.WithLabelValues(name).Observe(res.Duration.Seconds())
+
+	fields := map[string]interface{}{
+		"loader":   name,
+		"keys":     res.Keys,
+		"duration": res.Duration.String(),
+	}
+	if res.Err != nil {
+		warmupFailures.WithLabelValues(name).Inc()
+		fields["error"] = res.Err.Error()
+		logger.ErrorWithFields("cache warm-up loader failed", fields)
+	} else {
+		logger.InfoWithFields("cache warm-up loader done", fields)
+	}
+
+	return res
+}
+
+// load runs loader and writes its entries in batches, returning how many
+// entries were written.
+func (w *Runner) load(ctx context.Context, loader Loader) (int, error) {
+	entries, err := loader(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for start := 0; start < len(entries); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		end := start + batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := w.redis.SetMany(entries[start:end]); err != nil {
+			return written, err
+		}
+		written = end
+	}
+
+	return written, nil
+}